@@ -7,11 +7,15 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
 const notification_attribute_format = "notifications %s"
 
+// severity of the alert when the rule notified it, to detect escalations
+const notified_severity_attribute_format = "notified severity %s"
+
 type AlertaClient struct {
 	config Alerta
 }
@@ -23,6 +27,10 @@ type Alert struct {
 	Resource    string            `json:"resource"`
 	Severity    string            `json:"severity"`
 	Event       string            `json:"event"`
+	Group       string            `json:"group"`
+	Service     []string          `json:"service"`
+	Status      string            `json:"status"`
+	CreateTime  time.Time         `json:"createTime"`
 	Href        string            `json:"href"`
 	Attributes  map[string]string `json:"attributes"`
 
@@ -40,21 +48,71 @@ func (alert *Alert) AlreadyNotified(ruleId string) bool {
 }
 
 func (alert *Alert) Notified(ruleId string) {
+	if alert.Attributes == nil {
+		alert.Attributes = make(map[string]string)
+	}
 	alert.Attributes[fmt.Sprintf(notification_attribute_format, ruleId)] = time.Now().UTC().String()
+	alert.RecordSeverity(ruleId, alert.Severity)
+}
+
+// RecordSeverity records the severity the rule notified
+func (alert *Alert) RecordSeverity(ruleId string, severity string) {
+	if alert.Attributes == nil {
+		alert.Attributes = make(map[string]string)
+	}
+	alert.Attributes[fmt.Sprintf(notified_severity_attribute_format, ruleId)] = severity
+}
+
+// NotifiedSeverity returns the severity the rule notified, empty for alerts notified before severities were tracked
+func (alert *Alert) NotifiedSeverity(ruleId string) string {
+	return alert.Attributes[fmt.Sprintf(notified_severity_attribute_format, ruleId)]
+}
+
+// copy returns a copy of the alert that shares no attributes or services with it
+func (alert *Alert) copy() Alert {
+	copied := *alert
+	copied.Service = append([]string(nil), alert.Service...)
+	copied.Attributes = make(map[string]string, len(alert.Attributes))
+	for name, value := range alert.Attributes {
+		copied.Attributes[name] = value
+	}
+	return copied
 }
 
 func (alert *Alert) Color() string {
-	switch alert.Severity {
-	case "warning":
-		return "#17a2b8"
-	case "minor":
-		return "#ffc107"
-	case "major":
-		return "#dc3545"
-	case "critical":
-		return "#dc3545"
+	return severities.Color(alert.Severity)
+}
+
+func (alert *Alert) Emoji() string {
+	return severities.Emoji(alert.Severity)
+}
+
+// display name of the severity of the alert
+func (alert *Alert) SeverityName() string {
+	return severities.DisplayName(alert.Severity)
+}
+
+// Label returns the value of the alert field or, for unknown names, the alert attribute with the given name
+func (alert *Alert) Label(name string) string {
+	switch name {
+	case "id":
+		return alert.Id
+	case "environment":
+		return alert.Environment
+	case "resource":
+		return alert.Resource
+	case "event":
+		return alert.Event
+	case "severity":
+		return alert.Severity
+	case "group":
+		return alert.Group
+	case "status":
+		return alert.Status
+	case "service":
+		return strings.Join(alert.Service, ",")
 	default:
-		return "#343a40"
+		return alert.Attributes[name]
 	}
 }
 
@@ -84,6 +142,9 @@ func (client *AlertaClient) searchAlerts(rule Rule) []Alert {
 
 	for index, alert := range alertsResponse.Alerts {
 		alertsResponse.Alerts[index].Url = fmt.Sprintf("%v/#/alert/%v", client.config.Webui, alert.Id)
+		if alert.Attributes == nil {
+			alertsResponse.Alerts[index].Attributes = make(map[string]string)
+		}
 	}
 
 	closeError := resp.Body.Close()
@@ -94,6 +155,11 @@ func (client *AlertaClient) searchAlerts(rule Rule) []Alert {
 	return alertsResponse.Alerts
 }
 
+// link to the Alerta web UI showing the alerts matching the rule filter
+func (client *AlertaClient) alertsUrl(rule Rule) string {
+	return fmt.Sprintf("%v/#/alerts?%v", client.config.Webui, rule.Filter)
+}
+
 // http://docs.alerta.io/en/latest/api/reference.html#update-alert-attributes
 func (client *AlertaClient) updateAttributes(alert Alert, dryrun bool) error {
 
@@ -123,6 +189,43 @@ func (client *AlertaClient) updateAttributes(alert Alert, dryrun bool) error {
 	}
 }
 
+// http://docs.alerta.io/en/latest/api/reference.html#action-alert
+func (client *AlertaClient) action(alertId string, action string, text string, timeout int, dryrun bool) error {
+
+	url := fmt.Sprintf("%v/alert/%v/action", client.config.Endpoint, alertId)
+
+	var body = make(map[string]interface{})
+	body["action"] = action
+	body["text"] = text
+	if timeout > 0 {
+		body["timeout"] = timeout
+	}
+
+	jsn, marshallError := json.Marshal(body)
+	if marshallError != nil {
+		return marshallError
+	}
+
+	if dryrun {
+		log.Print("-- DryRun is active: not really performing alert action --")
+		log.Printf("Generated action request for Alerta API: [%v] \n%v", url, string(jsn))
+
+		return nil
+	}
+
+	response, err := client.performRequest("PUT", url, jsn)
+	if err != nil {
+		return err
+	}
+	log.Printf("< %v", response.Status)
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("alerta action '%v' on alert %v failed: %v", action, alertId, response.Status)
+	}
+	return nil
+}
+
 func (alerta *AlertaClient) performRequest(method string, url string, body []byte) (resp *http.Response, err error) {
 	log.Printf("> [%s] %s", method, url)
 	if body != nil {
@@ -140,7 +243,7 @@ func (alerta *AlertaClient) performRequest(method string, url string, body []byt
 	}
 	req.Header.Set("Content-Type", "application/json")
 	if alerta.config.ApiToken != "" {
-		req.Header.Set("X-API-Key", alerta.config.ApiToken)
+		req.Header.Set("X-API-Key", string(alerta.config.ApiToken))
 	}
 	client := &http.Client{}
 	return client.Do(req)
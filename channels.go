@@ -2,216 +2,652 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/slack-go/slack"
 	"html/template"
 	"log"
-	"path"
 	"strconv"
 	"strings"
+	texttemplate "text/template"
 	"time"
 )
 
 type Channel interface {
 	SendOpenAlerts(event OpenAlertsEvent, dryrun bool) error
 	SendClosedAlerts(event ClosedAlertsEvent, dryrun bool) error
+	SendFlappingAlerts(event FlappingAlertsEvent, dryrun bool) error
+	SendSeverityChanged(event SeverityChangedEvent, dryrun bool) error
 }
 
 type MailChannel struct {
-	Alerta   Alerta
-	settings Smtp
-	To       []string
-	TemplateOpen string
-	TemplateClosed string
+	Alerta           Alerta
+	settings         Smtp
+	pool             *SmtpPool
+	signer           *DkimSigner // nil when dkim signing is disabled
+	To               []string
+	Cc               []string
+	Bcc              []string
+	ReplyTo          string
+	TemplateOpen     string
+	TemplateClosed   string
+	TemplateFlapping string
+	TemplateSeverity string
+
+	TextTemplateOpen     string
+	TextTemplateClosed   string
+	TextTemplateFlapping string
+	TextTemplateSeverity string
+	SubjectTemplate      string
+	Language             string
+
+	location *time.Location // time zone of the times in the templates
 }
 
 type SlackChannel struct {
-	Alerta   Alerta
-	settings Slack
-	Channel  string
+	Alerta           Alerta
+	settings         Slack
+	Channel          string
+	TemplateOpen     string
+	TemplateClosed   string
+	TemplateFlapping string
+	TemplateSeverity string
+	Language         string
+
+	location *time.Location // time zone of the times in the templates
 }
 
 type OpenAlertsEvent struct {
+	Group           string
+	GroupLabels     map[string]string
 	NewAlertCount   int
 	NewAlerts       []Alert
 	AlreadyNotified int
+	Inhibited       []Alert
+
+	// Rule is the name of the rule that notifies the alerts
+	Rule string
+
+	// Storm is set when there are too many alerts for the channel, only a summary is sent with a link to AlertaUrl
+	Storm     bool
+	AlertaUrl string
+
+	// Language of the channel the event is sent to
+	Language string
 }
 
-type ClosedAlertsEvent struct {
+type FlappingAlertsEvent struct {
 	Alerts []Alert
+
+	Language string
+}
+
+// Notified alerts whose severity changed since they were notified
+type SeverityChangedEvent struct {
+	Group       string
+	GroupLabels map[string]string
+	Alerts      []Alert
+	Previous    map[string]string // notified severity by alert id
+	Increased   bool
+	Rule        string
+
+	AlertaUrl string
+	Language  string
+}
+
+type ClosedAlertsEvent struct {
+	Group       string
+	GroupLabels map[string]string
+	Alerts      []Alert
+	Rule        string
+
+	Storm     bool
+	AlertaUrl string
+
+	Language string
 }
 
 func LoadChannels(config Config) (map[string]Channel, error) {
 
 	var channels = make(map[string]Channel, len(config.Channels))
+	var smtpPool = NewSmtpPool()
 
 	for channelName, channel := range config.Channels {
 
+		location, locationError := channelLocation(channelName, channel.Config)
+		if locationError != nil {
+			return nil, locationError
+		}
+		language := channel.Config["language"]
+		if language != "" && !strings.HasPrefix(language, "en") && !hasCatalog(language) {
+			log.Printf("No message catalog for language '%v' of channel '%v', built-in texts are sent in English", language, channelName)
+		}
+
 		switch channel.Type {
 		case "mail":
 			tos, ok := channel.Config["to"]
 			if !ok {
 				return nil, errors.New(fmt.Sprintf("'to' property is required for channel '%v' of type 'mail' %v", channelName, channel.Type))
 			}
-			to := strings.Split(tos, ",")
-			for i, t := range to {
-				to[i] = strings.TrimSpace(t)
+			settings, settingsError := smtpSettings(config.ChannelSettings, channelName, channel.Config)
+			if settingsError != nil {
+				return nil, settingsError
 			}
 			templateAlertsOpenedFilename, _ := channel.Config["template_open"]
 			templateAlertsClosedFilename, _ := channel.Config["template_closed"]
+			templateAlertsFlappingFilename, _ := channel.Config["template_flapping"]
+			textTemplateAlertsOpenedFilename, _ := channel.Config["template_open_text"]
+			textTemplateAlertsClosedFilename, _ := channel.Config["template_closed_text"]
+			textTemplateAlertsFlappingFilename, _ := channel.Config["template_flapping_text"]
+			templateSeverityChangedFilename, _ := channel.Config["template_severity_changed"]
+			textTemplateSeverityChangedFilename, _ := channel.Config["template_severity_changed_text"]
+			subjectTemplate, _ := channel.Config["subject_template"]
+
+			var signer *DkimSigner
+			if settings.Dkim.Domain != "" {
+				var dkimError error
+				if signer, dkimError = NewDkimSigner(settings.Dkim); dkimError != nil {
+					return nil, errors.New(fmt.Sprintf("invalid dkim settings for channel '%v': %v", channelName, dkimError))
+				}
+			}
 
-			channels[channelName] = MailChannel{settings: config.ChannelSettings.Smtp, To: to, TemplateOpen: templateAlertsOpenedFilename, TemplateClosed:templateAlertsClosedFilename}
+			mailChannel := MailChannel{
+				settings:             settings,
+				pool:                 smtpPool,
+				signer:               signer,
+				To:                   splitAddresses(tos),
+				Cc:                   splitAddresses(channel.Config["cc"]),
+				Bcc:                  splitAddresses(channel.Config["bcc"]),
+				ReplyTo:              channel.Config["reply_to"],
+				TemplateOpen:         templateAlertsOpenedFilename,
+				TemplateClosed:       templateAlertsClosedFilename,
+				TemplateFlapping:     templateAlertsFlappingFilename,
+				TemplateSeverity:     templateSeverityChangedFilename,
+				TextTemplateOpen:     textTemplateAlertsOpenedFilename,
+				TextTemplateClosed:   textTemplateAlertsClosedFilename,
+				TextTemplateFlapping: textTemplateAlertsFlappingFilename,
+				TextTemplateSeverity: textTemplateSeverityChangedFilename,
+				SubjectTemplate:      subjectTemplate,
+				Language:             language,
+				location:             location,
+			}
+			if templateError := mailChannel.validateTemplates(); templateError != nil {
+				return nil, errors.New(fmt.Sprintf("channel '%v': %v", channelName, templateError))
+			}
+			channels[channelName] = mailChannel
 
 		case "slack":
+			settings, settingsError := slackSettings(config.ChannelSettings, channelName, channel.Config)
+			if settingsError != nil {
+				return nil, settingsError
+			}
 			slackChannel, ok := channel.Config["slack_channel"]
-			if !ok {
-				return nil, errors.New(fmt.Sprintf("'channel' property is required for channel '%v' of type 'slack' %v", channelName, channel.Type))
+			if !ok && settings.Token != "" {
+				return nil, errors.New(fmt.Sprintf("'slack_channel' property is required for channel '%v' of type 'slack' %v using a bot token", channelName, channel.Type))
+			}
+			if settings.Token == "" && settings.WebhookUrl == "" {
+				return nil, errors.New(fmt.Sprintf("'webhook_url' or 'token' is required for channel '%v' of type 'slack' %v", channelName, channel.Type))
+			}
+			templateOpen, _ := channel.Config["template_open"]
+			templateClosed, _ := channel.Config["template_closed"]
+			templateFlapping, _ := channel.Config["template_flapping"]
+			templateSeverity, _ := channel.Config["template_severity_changed"]
+
+			webhookChannel := SlackChannel{Alerta: config.Alerta, settings: settings, Channel: slackChannel, TemplateOpen: templateOpen, TemplateClosed: templateClosed, TemplateFlapping: templateFlapping, TemplateSeverity: templateSeverity, Language: language, location: location}
+			if templateError := webhookChannel.validateTemplates(); templateError != nil {
+				return nil, errors.New(fmt.Sprintf("channel '%v': %v", channelName, templateError))
+			}
+			if settings.Token != "" {
+				channels[channelName] = NewSlackAppChannel(channelName, webhookChannel)
+			} else {
+				channels[channelName] = webhookChannel
 			}
-			channels[channelName] = SlackChannel{settings: config.ChannelSettings.Slack, Channel: slackChannel}
 
 		default:
 			return nil, errors.New(fmt.Sprintf("Unknown channel type %v: valid types are %v", channel.Type, "mail, slack"))
 		}
+
+		limitedChannel, limitError := limitChannel(channelName, channels[channelName], channel.Config)
+		if limitError != nil {
+			return nil, limitError
+		}
+		channels[channelName] = limitedChannel
 	}
 	return channels, nil
 }
 
+// Resolves the smtp settings of a mail channel: the default settings or the named smtp profile,
+// with the sender optionally overridden by the channel config
+func smtpSettings(channelSettings ChannelSettings, channelName string, config map[string]string) (Smtp, error) {
+
+	settings := channelSettings.Smtp
+	if profile, ok := config["smtp_profile"]; ok {
+		settings, ok = channelSettings.SmtpProfiles[profile]
+		if !ok {
+			return settings, errors.New(fmt.Sprintf("unknown smtp profile '%v' for channel '%v'", profile, channelName))
+		}
+	}
+	if from, ok := config["from"]; ok {
+		settings.From = from
+	}
+	if fromName, ok := config["from_name"]; ok {
+		settings.FromName = fromName
+	}
+
+	switch strings.ToLower(settings.Tls) {
+	case "", TlsNone, TlsStartTls, TlsImplicit:
+	default:
+		return settings, errors.New(fmt.Sprintf("invalid tls mode '%v' for channel '%v': valid modes are none, starttls, implicit", settings.Tls, channelName))
+	}
+	switch settings.transport() {
+	case TransportSmtp, TransportSendmail:
+	case TransportFile, TransportMaildir:
+		if settings.Directory == "" {
+			return settings, errors.New(fmt.Sprintf("'directory' is required for the %v transport of channel '%v'", settings.transport(), channelName))
+		}
+	default:
+		return settings, errors.New(fmt.Sprintf("invalid mail transport '%v' for channel '%v': valid transports are smtp, sendmail, file, maildir", settings.Transport, channelName))
+	}
+	switch strings.ToUpper(settings.Auth) {
+	case "", "PLAIN", "LOGIN", "CRAM-MD5":
+	default:
+		return settings, errors.New(fmt.Sprintf("invalid smtp auth '%v' for channel '%v': valid mechanisms are PLAIN, LOGIN, CRAM-MD5", settings.Auth, channelName))
+	}
+	return settings, nil
+}
+
+// time zone of the times in the templates of a channel, by default the local time zone
+func channelLocation(channelName string, config map[string]string) (*time.Location, error) {
+	timezone, ok := config["timezone"]
+	if !ok {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid timezone '%v' for channel '%v': %v", timezone, channelName, err))
+	}
+	return location, nil
+}
+
+// splits a comma separated list of mail addresses
+func splitAddresses(addresses string) []string {
+	result := make([]string, 0)
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			result = append(result, address)
+		}
+	}
+	return result
+}
+
+// Resolves the Slack settings of a channel: the default settings or the settings of the named workspace,
+// with the webhook url and token optionally overridden by the channel config
+func slackSettings(channelSettings ChannelSettings, channelName string, config map[string]string) (Slack, error) {
+
+	settings := channelSettings.Slack
+	if workspace, ok := config["workspace"]; ok {
+		settings, ok = channelSettings.SlackWorkspaces[workspace]
+		if !ok {
+			return settings, errors.New(fmt.Sprintf("unknown slack workspace '%v' for channel '%v'", workspace, channelName))
+		}
+	}
+	if webhookUrl, ok := config["webhook_url"]; ok {
+		// the webhook of the channel replaces an inherited bot token, which would otherwise take precedence
+		settings.WebhookUrl = Secret(webhookUrl)
+		settings.Token = ""
+	}
+	if token, ok := config["token"]; ok {
+		settings.Token = Secret(token)
+	}
+	return settings, nil
+}
+
+// Wraps the channel in a LimitedChannel when rate limits or a storm threshold are configured
+func limitChannel(channelName string, channel Channel, config map[string]string) (Channel, error) {
+
+	limits := make(map[string]int)
+	for _, property := range []string{"rate_limit_per_minute", "rate_limit_per_hour", "storm_threshold"} {
+		if value, ok := config[property]; ok {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				return nil, errors.New(fmt.Sprintf("'%v' property of channel '%v' must be zero or a positive number: %v", property, channelName, value))
+			}
+			limits[property] = limit
+		}
+	}
+	if len(limits) == 0 {
+		return channel, nil
+	}
+
+	limiter := &RateLimiter{PerMinute: limits["rate_limit_per_minute"], PerHour: limits["rate_limit_per_hour"]}
+	return LimitedChannel{Name: channelName, Channel: channel, Limiter: limiter, StormThreshold: limits["storm_threshold"], queue: newAlertQueue()}, nil
+}
+
 func (mail MailChannel) SendOpenAlerts(event OpenAlertsEvent, dryrun bool) error {
 
-	mailTemplate := getOrElse(mail.TemplateOpen, "templates/open_alerts.gohtml")
-	body := render(mailTemplate, event)
+	event.Language = mail.Language
 
-	return mail.Send(event.Subject(), body, dryrun)
+	return mail.sendEvent(event, dryrun)
 }
 
 func (mail MailChannel) SendClosedAlerts(event ClosedAlertsEvent, dryrun bool) error {
 
-	mailTemplate := getOrElse(mail.TemplateClosed, "templates/closed_alerts.gohtml")
-	body := render(mailTemplate, event)
+	event.Language = mail.Language
+
+	return mail.sendEvent(event, dryrun)
+}
+
+func (mail MailChannel) SendFlappingAlerts(event FlappingAlertsEvent, dryrun bool) error {
+
+	event.Language = mail.Language
+
+	return mail.sendEvent(event, dryrun)
+}
+
+func (mail MailChannel) SendSeverityChanged(event SeverityChangedEvent, dryrun bool) error {
+
+	event.Language = mail.Language
+
+	return mail.sendEvent(event, dryrun)
+}
+
+// the html and text template of the channel for the event
+func (mail MailChannel) mailTemplates(event alertEvent) (string, string) {
+	switch typed := event.(type) {
+	case OpenAlertsEvent:
+		if typed.Storm {
+			return "templates/storm_alerts.gohtml", "templates/storm_alerts.gotxt"
+		}
+		return getOrElse(mail.TemplateOpen, "templates/open_alerts.gohtml"), mailTextTemplate(mail.TemplateOpen, mail.TextTemplateOpen, "templates/open_alerts.gotxt")
+	case ClosedAlertsEvent:
+		if typed.Storm {
+			return "templates/storm_alerts.gohtml", "templates/storm_alerts.gotxt"
+		}
+		return getOrElse(mail.TemplateClosed, "templates/closed_alerts.gohtml"), mailTextTemplate(mail.TemplateClosed, mail.TextTemplateClosed, "templates/closed_alerts.gotxt")
+	case SeverityChangedEvent:
+		return getOrElse(mail.TemplateSeverity, "templates/severity_changed.gohtml"), mailTextTemplate(mail.TemplateSeverity, mail.TextTemplateSeverity, "templates/severity_changed.gotxt")
+	default:
+		return getOrElse(mail.TemplateFlapping, "templates/flapping_alerts.gohtml"), mailTextTemplate(mail.TemplateFlapping, mail.TextTemplateFlapping, "templates/flapping_alerts.gotxt")
+	}
+}
 
-	return mail.Send(event.Subject(), body, dryrun)
+// the text template of a mail: the configured one, or the default one for the default html template. Without a text
+// template the text is derived from the rendered html, so it says the same as a custom html template.
+func mailTextTemplate(htmlTemplate string, textTemplate string, defaultTemplate string) string {
+	if textTemplate != "" || htmlTemplate != "" {
+		return textTemplate
+	}
+	return defaultTemplate
 }
 
-func render(filename string, event interface{}) string {
+func (mail MailChannel) sendEvent(event alertEvent, dryrun bool) error {
+	subject, body, text, renderError := mail.renderMail(event)
+	return fallbackError(renderError, mail.Send(subject, body, text, dryrun))
+}
+
+// renders the subject, html and text of the mail, the parts that can't be rendered are replaced by a plain fallback message
+func (mail MailChannel) renderMail(event alertEvent) (string, string, string, error) {
+
+	htmlTemplate, textTemplate := mail.mailTemplates(event)
+
+	subject, subjectError := mail.subject(event)
+	if subjectError != nil {
+		subject = event.Subject()
+	}
+	body, bodyError := mail.render(htmlTemplate, event)
+	if bodyError != nil {
+		body = "<pre>" + template.HTMLEscapeString(fallbackText(event)) + "</pre>"
+	}
+	var text string
+	var textError error
+	if textTemplate == "" {
+		text = htmlToText(body)
+	} else if text, textError = mail.renderText(textTemplate, event); textError != nil {
+		text = fallbackText(event)
+	}
+
+	renderError := subjectError
+	if renderError == nil {
+		renderError = textError
+	}
+	if renderError == nil {
+		renderError = bodyError
+	}
+	return subject, body, text, renderError
+}
+
+// renders the subject_template of the channel against the event, or the default subject of the event
+func (mail MailChannel) subject(event alertEvent) (string, error) {
+	if mail.SubjectTemplate == "" {
+		return event.Subject(), nil
+	}
+
+	var result bytes.Buffer
+	t, err := texttemplate.New("subject").Funcs(mail.textFuncs()).Parse(mail.SubjectTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid subject template '%v': %v", mail.SubjectTemplate, err)
+	}
+	if err := t.Execute(&result, event); err != nil {
+		return "", fmt.Errorf("cannot render subject template '%v': %v", mail.SubjectTemplate, err)
+	}
+	return strings.TrimSpace(result.String()), nil
+}
+
+// parses all templates of the channel, so broken or missing templates are reported at startup
+func (mail MailChannel) validateTemplates() error {
+	htmlTemplates := []string{
+		getOrElse(mail.TemplateOpen, "templates/open_alerts.gohtml"),
+		getOrElse(mail.TemplateClosed, "templates/closed_alerts.gohtml"),
+		getOrElse(mail.TemplateFlapping, "templates/flapping_alerts.gohtml"),
+		getOrElse(mail.TemplateSeverity, "templates/severity_changed.gohtml"),
+		"templates/storm_alerts.gohtml",
+	}
+	for _, filename := range htmlTemplates {
+		filename = localizedTemplate(filename, mail.Language)
+		if _, err := templates.htmlTemplate(filename, mail.htmlFuncs()); err != nil {
+			return fmt.Errorf("invalid template %v: %v", filename, err)
+		}
+	}
+	textTemplates := []string{
+		mailTextTemplate(mail.TemplateOpen, mail.TextTemplateOpen, "templates/open_alerts.gotxt"),
+		mailTextTemplate(mail.TemplateClosed, mail.TextTemplateClosed, "templates/closed_alerts.gotxt"),
+		mailTextTemplate(mail.TemplateFlapping, mail.TextTemplateFlapping, "templates/flapping_alerts.gotxt"),
+		mailTextTemplate(mail.TemplateSeverity, mail.TextTemplateSeverity, "templates/severity_changed.gotxt"),
+		"templates/storm_alerts.gotxt",
+	}
+	for _, filename := range textTemplates {
+		if filename == "" {
+			continue
+		}
+		filename = localizedTemplate(filename, mail.Language)
+		if _, err := templates.textTemplate(filename, mail.textFuncs()); err != nil {
+			return fmt.Errorf("invalid template %v: %v", filename, err)
+		}
+	}
+	if _, err := texttemplate.New("subject").Funcs(mail.textFuncs()).Parse(mail.SubjectTemplate); err != nil {
+		return fmt.Errorf("invalid subject template '%v': %v", mail.SubjectTemplate, err)
+	}
+	return nil
+}
+
+func (mail MailChannel) htmlFuncs() template.FuncMap {
+	return template.FuncMap(alertFuncs(mail.location, mail.Language))
+}
+
+func (mail MailChannel) textFuncs() texttemplate.FuncMap {
+	return texttemplate.FuncMap(alertFuncs(mail.location, mail.Language))
+}
+
+func (mail MailChannel) render(filename string, event interface{}) (string, error) {
 
 	var result bytes.Buffer
 
-	base := path.Base(filename)
-	t := template.Must(template.New(base).ParseFiles(filename))
+	filename = localizedTemplate(filename, mail.Language)
+	t, err := templates.htmlTemplate(filename, mail.htmlFuncs())
+	if err != nil {
+		return "", fmt.Errorf("cannot load template %v: %v", filename, err)
+	}
+	if err := t.Execute(&result, event); err != nil {
+		return "", fmt.Errorf("cannot render template %v: %v", filename, err)
+	}
+
+	return result.String(), nil
+}
+
+func (mail MailChannel) renderText(filename string, event interface{}) (string, error) {
 
-	err := t.Execute(&result, event)
+	var result bytes.Buffer
+
+	filename = localizedTemplate(filename, mail.Language)
+	t, err := templates.textTemplate(filename, mail.textFuncs())
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("cannot load template %v: %v", filename, err)
+	}
+	if err := t.Execute(&result, event); err != nil {
+		return "", fmt.Errorf("cannot render template %v: %v", filename, err)
 	}
 
-	return result.String()
+	return result.String(), nil
 }
 
 func (slackChannel SlackChannel) SendOpenAlerts(event OpenAlertsEvent, dryrun bool) error {
 
-	msg := event.toWebhookMessage(slackChannel)
+	event.Language = slackChannel.Language
+	msg, renderError := event.toWebhookMessage(slackChannel)
 
-	return slackChannel.send(event.Subject(), msg, dryrun)
+	return fallbackError(renderError, slackChannel.send(event.Subject(), msg, dryrun))
 }
 
 func (slackChannel SlackChannel) SendClosedAlerts(event ClosedAlertsEvent, dryrun bool) error {
 
-	msg := event.toWebhookMessage(slackChannel)
+	event.Language = slackChannel.Language
+	msg, renderError := event.toWebhookMessage(slackChannel)
 
-	return slackChannel.send(event.Subject(), msg, dryrun)
+	return fallbackError(renderError, slackChannel.send(event.Subject(), msg, dryrun))
+}
+
+func (slackChannel SlackChannel) SendFlappingAlerts(event FlappingAlertsEvent, dryrun bool) error {
+
+	event.Language = slackChannel.Language
+	msg, renderError := event.toWebhookMessage(slackChannel)
+
+	return fallbackError(renderError, slackChannel.send(event.Subject(), msg, dryrun))
+}
+
+func (slackChannel SlackChannel) SendSeverityChanged(event SeverityChangedEvent, dryrun bool) error {
+
+	event.Language = slackChannel.Language
+	msg, renderError := event.toWebhookMessage(slackChannel)
+
+	return fallbackError(renderError, slackChannel.send(event.Subject(), msg, dryrun))
 }
 
 func (slackChannel SlackChannel) send(subject string, body slack.WebhookMessage, dryrun bool) error {
 
 	if dryrun {
 		log.Print("-- DryRun is active: not really posting to slack --")
-
-		if raw, err := json.Marshal(body); err != nil {
-			log.Printf("Error marshalling slack message to json: %v", err)
-			return err
-		} else {
-			log.Printf("Posting slack message:\n%v", string(raw))
-			return nil
-		}
+		return logSlackMessage(body)
 	} else {
 		log.Printf("Posting webhook msg to slack: %v", subject)
-		return slack.PostWebhook(slackChannel.settings.WebhookUrl, &body)
+		return slack.PostWebhook(string(slackChannel.settings.WebhookUrl), &body)
 	}
 }
 
-func (event OpenAlertsEvent) toWebhookMessage(slackChannel SlackChannel) slack.WebhookMessage {
-
-	var attachments = make([]slack.Attachment, event.NewAlertCount)
-
-	for index, alert := range event.NewAlerts {
+func (event OpenAlertsEvent) toWebhookMessage(slackChannel SlackChannel) (slack.WebhookMessage, error) {
+	event.Language = slackChannel.Language
+	if event.Storm {
+		return slackChannel.renderMessage("templates/slack_storm_alerts.gojson", event)
+	}
+	return slackChannel.renderMessage(getOrElse(slackChannel.TemplateOpen, "templates/slack_open_alerts.gojson"), event)
+}
 
-		attachments[index] = slack.Attachment{
-			Color: alert.Color(),
-			//AuthorName: "Alerta Notifications",
-			//AuthorLink: slackChannel.Alerta.Webui,
+func (event ClosedAlertsEvent) toWebhookMessage(slackChannel SlackChannel) (slack.WebhookMessage, error) {
+	event.Language = slackChannel.Language
+	if event.Storm {
+		return slackChannel.renderMessage("templates/slack_storm_alerts.gojson", event)
+	}
+	return slackChannel.renderMessage(getOrElse(slackChannel.TemplateClosed, "templates/slack_closed_alerts.gojson"), event)
+}
 
-			Text: fmt.Sprintf("<%v|%v> - `%v` \n%v", alert.Url, alert.Resource, alert.Event, alert.Text),
+func (event FlappingAlertsEvent) toWebhookMessage(slackChannel SlackChannel) (slack.WebhookMessage, error) {
+	event.Language = slackChannel.Language
+	return slackChannel.renderMessage(getOrElse(slackChannel.TemplateFlapping, "templates/slack_flapping_alerts.gojson"), event)
+}
 
-			Footer: "Alerta Notifications",
-			Ts:     json.Number(strconv.FormatInt(time.Now().Unix(), 10)),
+func (event SeverityChangedEvent) toWebhookMessage(slackChannel SlackChannel) (slack.WebhookMessage, error) {
+	event.Language = slackChannel.Language
+	return slackChannel.renderMessage(getOrElse(slackChannel.TemplateSeverity, "templates/slack_severity_changed.gojson"), event)
+}
 
-			Fields: []slack.AttachmentField{
-				slack.AttachmentField{
-					Title: "Severity",
-					Value: alert.Severity,
-					Short: true,
-				},
-				slack.AttachmentField{
-					Title: "Environment",
-					Value: alert.Environment,
-					Short: true,
-				},
-			},
+func (event OpenAlertsEvent) Subject() string {
+	if event.Storm {
+		if event.Group != "" {
+			return translatef(event.Language, "%v new alerts on %v, see Alerta", event.NewAlertCount, event.Group)
 		}
+		return translatef(event.Language, "%v new alerts, see Alerta", event.NewAlertCount)
 	}
-	msg := slack.WebhookMessage{
-		IconEmoji:   ":rocket:",
-		Text:        event.Subject(),
-		Channel:     slackChannel.Channel,
-		Attachments: attachments,
+	if event.Group != "" {
+		if event.NewAlertCount > 1 {
+			return translatef(event.Language, "%v alerts on %v", event.NewAlertCount, event.Group)
+		}
+		return translatef(event.Language, "New alert on %v: %s", event.Group, event.NewAlerts[0].Resource)
 	}
-	return msg
+	if event.NewAlertCount > 1 {
+		return translatef(event.Language, "%v new alerts", event.NewAlertCount)
+	}
+	return translatef(event.Language, "New alert: %s", event.NewAlerts[0].Resource)
 }
 
-func (event ClosedAlertsEvent) toWebhookMessage(slackChannel SlackChannel) slack.WebhookMessage {
-
-	var attachments = make([]slack.Attachment, len(event.Alerts))
-
-	for index, alert := range event.Alerts {
-
-		attachments[index] = slack.Attachment{
-			Color: "#28a745",
-			Text:  fmt.Sprintf("<%v|%v> - `%v`", alert.Url, alert.Resource, alert.Event),
+func (event ClosedAlertsEvent) Subject() string {
+	if event.Storm {
+		if event.Group != "" {
+			return translatef(event.Language, "%v closed alerts on %v, see Alerta", len(event.Alerts), event.Group)
 		}
+		return translatef(event.Language, "%v closed alerts, see Alerta", len(event.Alerts))
 	}
-	msg := slack.WebhookMessage{
-		IconEmoji:   ":rocket:",
-		Text:        event.Subject(),
-		Channel:     slackChannel.Channel,
-		Attachments: attachments,
+	if event.Group != "" {
+		if len(event.Alerts) > 1 {
+			return translatef(event.Language, "%v alerts were closed on %v", len(event.Alerts), event.Group)
+		}
+		return translatef(event.Language, "Closed alert on %v: %v", event.Group, event.Alerts[0].Resource)
 	}
-	return msg
+	if len(event.Alerts) > 1 {
+		return translatef(event.Language, "%v alerts were closed", len(event.Alerts))
+	}
+	return translatef(event.Language, "Closed alert: %v", event.Alerts[0].Resource)
 }
 
-func (event OpenAlertsEvent) Subject() string {
-	if event.NewAlertCount > 1 {
-		return fmt.Sprintf("%v new alerts", event.NewAlertCount)
+func (event FlappingAlertsEvent) Subject() string {
+	if len(event.Alerts) > 1 {
+		return translatef(event.Language, "%v alerts are flapping", len(event.Alerts))
 	}
-	return fmt.Sprintf("New alert: %s", event.NewAlerts[0].Resource)
+	return translatef(event.Language, "Alert is flapping: %v", event.Alerts[0].Resource)
 }
 
-func (event ClosedAlertsEvent) Subject() string {
+func (event SeverityChangedEvent) Subject() string {
 	if len(event.Alerts) > 1 {
-		return fmt.Sprintf("%v alerts were closed", len(event.Alerts))
+		if event.Group != "" {
+			if event.Increased {
+				return translatef(event.Language, "Severity of %v alerts on %v increased", len(event.Alerts), event.Group)
+			}
+			return translatef(event.Language, "Severity of %v alerts on %v decreased", len(event.Alerts), event.Group)
+		}
+		if event.Increased {
+			return translatef(event.Language, "Severity of %v alerts increased", len(event.Alerts))
+		}
+		return translatef(event.Language, "Severity of %v alerts decreased", len(event.Alerts))
+	}
+	alert := event.Alerts[0]
+	previous := severities.DisplayName(event.PreviousSeverity(alert.Id))
+	if event.Increased {
+		return translatef(event.Language, "Severity of %v increased from %v to %v", alert.Resource, previous, alert.SeverityName())
 	}
-	return fmt.Sprintf("Closed alert: %v", event.Alerts[0].Resource)
+	return translatef(event.Language, "Severity of %v decreased from %v to %v", alert.Resource, previous, alert.SeverityName())
+}
+
+// PreviousSeverity is the severity the alert had when it was notified: {{ $.PreviousSeverity .Id | severityName }}
+func (event SeverityChangedEvent) PreviousSeverity(alertId string) string {
+	return event.Previous[alertId]
 }
 
 func getOrElse(attempt string, fallback string) string {
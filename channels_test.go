@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/slack-go/slack"
 	"io/ioutil"
 	"log"
+	"path"
+	"strings"
 	"testing"
 )
 
@@ -28,18 +32,143 @@ func TestLoadChannelsConfig(t *testing.T) {
 	}
 }
 
+func TestSmtpProfileSettings(t *testing.T) {
+
+	channelSettings := ChannelSettings{
+		Smtp:         Smtp{Server: "smtp.example.com", From: "ops@example.com"},
+		SmtpProfiles: map[string]Smtp{"marketing": {Server: "relay.example.com", From: "marketing@example.com"}},
+	}
+
+	settings, err := smtpSettings(channelSettings, "webshop", map[string]string{"smtp_profile": "marketing", "from_name": "Webshop"})
+	if err != nil || settings.Server != "relay.example.com" || settings.From != "marketing@example.com" || settings.FromName != "Webshop" {
+		t.Fatalf("expected marketing profile with overridden from name, got %v (%v)", settings, err)
+	}
+
+	if _, err = smtpSettings(channelSettings, "unknown", map[string]string{"smtp_profile": "unknown"}); err == nil {
+		t.Fatalf("expected error for unknown smtp profile")
+	}
+
+	channel := MailChannel{settings: settings, To: splitAddresses("a@example.com, b@example.com"), Bcc: splitAddresses("audit@example.com"), ReplyTo: "support@example.com"}
+	if recipients := channel.recipients(); len(recipients) != 3 {
+		t.Fatalf("expected 3 recipients, got %v", recipients)
+	}
+	var raw bytes.Buffer
+	if _, err := channel.message("subject", "html", "text").WriteTo(&raw); err != nil {
+		t.Fatalf("cannot write message: %v", err)
+	}
+	if strings.Contains(raw.String(), "audit@example.com") || !strings.Contains(raw.String(), "Reply-To: support@example.com") {
+		t.Fatalf("unexpected message headers:\n%v", raw.String())
+	}
+}
+
+func TestSlackWorkspaceSettings(t *testing.T) {
+
+	channelSettings := ChannelSettings{
+		Slack:           Slack{WebhookUrl: "https://hooks.slack.com/services/1/2/3"},
+		SlackWorkspaces: map[string]Slack{"customer": {Token: "xoxb-customer"}},
+	}
+
+	settings, err := slackSettings(channelSettings, "webshop", map[string]string{"webhook_url": "https://hooks.slack.com/services/4/5/6"})
+	if err != nil || settings.WebhookUrl != "https://hooks.slack.com/services/4/5/6" {
+		t.Fatalf("expected webhook url of the channel, got %v (%v)", settings, err)
+	}
+
+	settings, err = slackSettings(channelSettings, "customer", map[string]string{"workspace": "customer"})
+	if err != nil || settings.Token != "xoxb-customer" || settings.WebhookUrl != "" {
+		t.Fatalf("expected settings of the customer workspace, got %v (%v)", settings, err)
+	}
+
+	settings, err = slackSettings(channelSettings, "customer-webhook", map[string]string{"workspace": "customer", "webhook_url": "https://hooks.slack.com/services/7/8/9"})
+	if err != nil || settings.Token != "" || settings.WebhookUrl != "https://hooks.slack.com/services/7/8/9" {
+		t.Fatalf("expected the webhook url of the channel to replace the token of the workspace, got %v (%v)", settings, err)
+	}
+
+	if _, err = slackSettings(channelSettings, "unknown", map[string]string{"workspace": "unknown"}); err == nil {
+		t.Fatalf("expected error for unknown workspace")
+	}
+}
+
 func TestMailTemplateOpenAlerts(t *testing.T) {
 
 	mockAlertEvent := OpenAlertsEvent{AlreadyNotified: 20, NewAlertCount: 5, NewAlerts: readAlerts(t)}
 
-	log.Print(render("templates/open_alerts.gohtml", mockAlertEvent))
+	body, err := MailChannel{}.render("templates/open_alerts.gohtml", mockAlertEvent)
+	if err != nil {
+		t.Fatalf("cannot render template: %v", err)
+	}
+	log.Print(body)
 }
 
 func TestMailTemplateClosedAlerts(t *testing.T) {
 
 	mockAlertEvent := ClosedAlertsEvent{Alerts: readAlerts(t)}
 
-	log.Print(render("templates/closed_alerts.gohtml", mockAlertEvent))
+	body, err := MailChannel{}.render("templates/closed_alerts.gohtml", mockAlertEvent)
+	if err != nil {
+		t.Fatalf("cannot render template: %v", err)
+	}
+	log.Print(body)
+}
+
+func TestMailTextTemplates(t *testing.T) {
+
+	alerts := readAlerts(t)
+	for _, filename := range []string{"templates/open_alerts.gotxt", "templates/closed_alerts.gotxt", "templates/flapping_alerts.gotxt", "templates/storm_alerts.gotxt"} {
+		var event interface{} = ClosedAlertsEvent{Alerts: alerts}
+		if filename == "templates/open_alerts.gotxt" {
+			event = OpenAlertsEvent{AlreadyNotified: 20, NewAlertCount: len(alerts), NewAlerts: alerts, Inhibited: alerts[:1]}
+		} else if filename == "templates/flapping_alerts.gotxt" {
+			event = FlappingAlertsEvent{Alerts: alerts}
+		}
+
+		text, err := MailChannel{}.renderText(filename, event)
+		if err != nil {
+			t.Fatalf("cannot render %v: %v", filename, err)
+		}
+		log.Print(text)
+	}
+}
+
+func TestMailTextIsDerivedFromCustomHtmlTemplate(t *testing.T) {
+
+	directory := t.TempDir()
+	custom := path.Join(directory, "custom.gohtml")
+	ioutil.WriteFile(custom, []byte("<html><head><style>p { color: red }</style></head><body><h1>Nieuwe meldingen</h1>"+
+		"<ul>{{ range .NewAlerts }}<li>{{ .Resource }} &amp; {{ .Event }}</li>{{ end }}</ul></body></html>"), 0644)
+
+	channel := MailChannel{TemplateOpen: custom}
+	alert := Alert{Resource: "db", Event: "down", Severity: "major"}
+	_, _, text, err := channel.renderMail(OpenAlertsEvent{NewAlertCount: 1, NewAlerts: []Alert{alert}})
+	if err != nil {
+		t.Fatalf("cannot render mail: %v", err)
+	}
+	if text != "Nieuwe meldingen\n- db & down\n" {
+		t.Fatalf("expected the text of the custom html template, got %q", text)
+	}
+}
+
+func TestMailSubjectTemplateAndAlternatives(t *testing.T) {
+
+	channel := MailChannel{To: []string{"user@example.com"}, SubjectTemplate: "[{{ .Group }}] {{ .Subject }}"}
+	event := OpenAlertsEvent{Group: "Production/webshop", NewAlertCount: 1, NewAlerts: []Alert{{Resource: "db"}}}
+
+	subject, err := channel.subject(event)
+	if err != nil {
+		t.Fatalf("cannot render subject: %v", err)
+	}
+	if subject != "[Production/webshop] New alert on Production/webshop: db" {
+		t.Fatalf("unexpected subject '%v'", subject)
+	}
+
+	var raw bytes.Buffer
+	if _, err := channel.message(subject, "<p>html</p>", "text").WriteTo(&raw); err != nil {
+		t.Fatalf("cannot write message: %v", err)
+	}
+	for _, expected := range []string{"multipart/alternative", "text/plain", "text/html"} {
+		if !strings.Contains(raw.String(), expected) {
+			t.Fatalf("expected %v in message:\n%v", expected, raw.String())
+		}
+	}
 }
 
 func TestSlackMarshalling(t *testing.T) {
@@ -47,7 +176,10 @@ func TestSlackMarshalling(t *testing.T) {
 	mockAlertEvent := OpenAlertsEvent{AlreadyNotified: 20, NewAlertCount: 5, NewAlerts: readAlerts(t)}
 	mockChannel := SlackChannel{Channel: "test", Alerta: Alerta{Webui: "http://localhost:8282/alerta"}}
 
-	msg := mockAlertEvent.toWebhookMessage(mockChannel)
+	msg, renderError := mockAlertEvent.toWebhookMessage(mockChannel)
+	if renderError != nil {
+		t.Fatalf("cannot render webhook message: %v", renderError)
+	}
 
 	raw, err := json.Marshal(msg)
 	if err != nil {
@@ -57,6 +189,39 @@ func TestSlackMarshalling(t *testing.T) {
 	log.Print(string(raw))
 }
 
+func TestSlackYamlTemplate(t *testing.T) {
+
+	filename := path.Join(t.TempDir(), "slack.goyaml")
+	template := `
+username: Webshop alerts
+icon_emoji: ":fire:"
+text: {{ json .Subject }}
+blocks:
+  - type: section
+    text:
+      type: mrkdwn
+      text: "{{ if anySeverity .NewAlerts "critical" }}<!here> {{ end }}{{ .Subject }}"
+`
+	if err := ioutil.WriteFile(filename, []byte(template), 0644); err != nil {
+		t.Fatalf("cannot write template: %v", err)
+	}
+
+	mockAlertEvent := OpenAlertsEvent{NewAlertCount: 1, NewAlerts: []Alert{{Resource: "db", Severity: "critical"}}}
+	mockChannel := SlackChannel{Channel: "test", TemplateOpen: filename}
+
+	msg, err := mockAlertEvent.toWebhookMessage(mockChannel)
+	if err != nil {
+		t.Fatalf("cannot render yaml template: %v", err)
+	}
+	if msg.Username != "Webshop alerts" || msg.Channel != "test" || msg.Blocks == nil || len(msg.Blocks.BlockSet) != 1 {
+		t.Fatalf("unexpected message %v", msg)
+	}
+	section := msg.Blocks.BlockSet[0].(*slack.SectionBlock)
+	if section.Text.Text != "<!here> New alert: db" {
+		t.Fatalf("unexpected section text '%v'", section.Text.Text)
+	}
+}
+
 func readAlerts(t *testing.T) []Alert {
 	var alertsResponse AlertsResponse
 
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"gopkg.in/yaml.v2"
+	"bytes"
+	"gopkg.in/yaml.v3"
+	"io"
 	"io/ioutil"
-	"time"
 )
 
 type Config struct {
@@ -13,33 +14,96 @@ type Config struct {
 	ChannelSettings ChannelSettings          `yaml:"channel_settings"`
 	Channels        map[string]ChannelConfig `yaml:"channels"`
 	Rules           map[string]Rule          `yaml:"rules"`
+	InhibitRules    []InhibitRule            `yaml:"inhibit_rules"`
+	Severities      []Severity               `yaml:"severities"` // by default the Alerta severities
+
+	// files, directories or glob patterns with more channels and rules, e.g. conf.d
+	Include []string `yaml:"include"`
+
+	// number of rules evaluated at the same time, 4 by default
+	Workers int `yaml:"workers"`
 }
 
 type Alerta struct {
-	Endpoint       string        `yaml:"endpoint"`
-	Webui          string        `yaml:"webui"`
-	ApiToken       string        `yaml:"apiToken"`
-	ReloadInterval time.Duration `yaml:"reload_interval"`
+	Endpoint       string   `yaml:"endpoint"`
+	Webui          string   `yaml:"webui"`
+	ApiToken       Secret   `yaml:"apiToken"`
+	ApiTokenFile   string   `yaml:"api_token_file"`
+	ReloadInterval Duration `yaml:"reload_interval"`
 }
 
 type ChannelSettings struct {
-	Slack Slack `yaml:"slack"`
-	Smtp  Smtp  `yaml:"smtp"`
+	Slack           Slack            `yaml:"slack"`
+	SlackWorkspaces map[string]Slack `yaml:"slack_workspaces"`
+	Smtp            Smtp             `yaml:"smtp"`
+	SmtpProfiles    map[string]Smtp  `yaml:"smtp_profiles"`
 }
 
 type Slack struct {
-	WebhookUrl string `yaml:"webhook_url"`
+	WebhookUrl    Secret            `yaml:"webhook_url"`
+	Token         Secret            `yaml:"token"` // bot token, when set messages are posted with the Web API instead of the webhook
+	SigningSecret Secret            `yaml:"signing_secret"`
+	Interactions  SlackInteractions `yaml:"interactions"`
+
+	// the secrets can be read from a file instead, e.g. a mounted Kubernetes or Docker secret
+	WebhookUrlFile    string `yaml:"webhook_url_file"`
+	TokenFile         string `yaml:"token_file"`
+	SigningSecretFile string `yaml:"signing_secret_file"`
+}
+
+// Endpoint receiving the Slack button clicks, buttons are only added when a signing secret is configured
+type SlackInteractions struct {
+	Listen string            `yaml:"listen"` // e.g. ':8080'
+	Path   string            `yaml:"path"`
+	Users  map[string]string `yaml:"users"` // Slack user id to the name used in the Alerta action text
+}
+
+func (settings Slack) Interactive() bool {
+	return settings.SigningSecret != "" && settings.Interactions.Listen != ""
+}
+
+// AllSlack returns the default Slack settings and the settings of all named workspaces
+func (channelSettings ChannelSettings) AllSlack() []Slack {
+	all := []Slack{channelSettings.Slack}
+	for _, workspace := range channelSettings.SlackWorkspaces {
+		all = append(all, workspace)
+	}
+	return all
 }
 
 type Smtp struct {
 	Server    string `yaml:"server"`
 	Port      int    `yaml:"port"` // 465 for ssl, 587 for non-ssl
 	User      string `yaml:"user"`
-	Password  string `yaml:"password"`
+	Password  Secret `yaml:"password"`
 	From      string `yaml:"from"`
 	FromName  string `yaml:"from_name"`
 	Anonymous bool   `yaml:"anonymous"`
-	Ssl       bool   `yaml:"ssl"`
+	Ssl       bool   `yaml:"ssl"` // deprecated, same as tls: implicit
+
+	PasswordFile string `yaml:"password_file"`
+
+	Tls                string   `yaml:"tls"` // none, starttls or implicit, by default STARTTLS is used when supported
+	CaFile             string   `yaml:"ca_file"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify"`
+	Auth               string   `yaml:"auth"` // PLAIN (default), LOGIN or CRAM-MD5
+	Timeout            Duration `yaml:"timeout"`
+
+	Dkim Dkim `yaml:"dkim"`
+
+	Transport    string   `yaml:"transport"`     // smtp (default), sendmail, file or maildir
+	SendmailPath string   `yaml:"sendmail_path"` // default /usr/sbin/sendmail
+	SendmailArgs []string `yaml:"sendmail_args"`
+	Directory    string   `yaml:"directory"` // target directory of the file and maildir transports
+}
+
+// DKIM signing of outgoing mails, enabled when a domain is configured.
+// The public key is published in the TXT record <selector>._domainkey.<domain>
+type Dkim struct {
+	Domain         string   `yaml:"domain"`
+	Selector       string   `yaml:"selector"`
+	PrivateKeyFile string   `yaml:"private_key_file"`
+	Headers        []string `yaml:"headers"` // signed headers, by default From, Subject, Date, To, ...
 }
 
 type ChannelConfig struct {
@@ -50,10 +114,66 @@ type ChannelConfig struct {
 type Rule struct {
 	Filter   string   `yaml:"filter"`
 	Channels []string `yaml:"channels"`
+	GroupBy  []string `yaml:"group_by"`
+	For      Duration `yaml:"for"`      // how long an alert must be open before it is notified
+	Interval Duration `yaml:"interval"` // how often the rule is evaluated, by default the reload_interval
+	Flapping Flapping `yaml:"flapping"`
+
+	// alerts less severe than the minimum severity are ignored by the rule
+	MinSeverity string `yaml:"min_severity"`
+
+	// notified alerts that become more severe are notified again, less severe only when enabled
+	NotifySeverityDecrease bool `yaml:"notify_severity_decrease"`
+}
+
+// An alert is flapping when it opens or closes Threshold times within Window,
+// transitions are suppressed until it hasn't changed for StablePeriod
+type Flapping struct {
+	Threshold    int      `yaml:"threshold"`
+	Window       Duration `yaml:"window"`
+	StablePeriod Duration `yaml:"stable_period"`
+}
+
+// A severity level, the configured severities are ordered from most to least severe
+type Severity struct {
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"display_name"`
+	Color       string `yaml:"color"`
+	Emoji       string `yaml:"emoji"`
+}
+
+// An open alert matching SourceMatch suppresses notifications for alerts matching TargetMatch
+// that have the same values for all Equal labels (e.g. environment, resource)
+type InhibitRule struct {
+	SourceMatch map[string]string `yaml:"source_match"`
+	TargetMatch map[string]string `yaml:"target_match"`
+	Equal       []string          `yaml:"equal"`
 }
 
 func Load(filename string) (Config, error) {
 
+	positions := make(configPositions)
+
+	config, parseError := parseConfig(filename, positions, nil)
+	if parseError != nil {
+		return config, parseError
+	}
+
+	if includeError := loadIncludes(&config, filename, positions); includeError != nil {
+		return config, includeError
+	}
+
+	if secretsError := resolveSecrets(&config); secretsError != nil {
+		return config, secretsError
+	}
+
+	return config, validateConfig(config, positions)
+}
+
+// parses a configuration file, unknown keys are an error, and records the positions of its keys
+// with the list items numbered after the given offsets
+func parseConfig(filename string, positions configPositions, offsets map[string]int) (Config, error) {
+
 	var config Config
 
 	data, readFileError := ioutil.ReadFile(filename)
@@ -61,10 +181,16 @@ func Load(filename string) (Config, error) {
 		return config, readFileError
 	}
 
-	unmarshallError := yaml.Unmarshal(data, &config)
-	if unmarshallError != nil {
-		return config, unmarshallError
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if unmarshallError := decoder.Decode(&config); unmarshallError != nil && unmarshallError != io.EOF {
+		return config, yamlError(filename, unmarshallError)
 	}
 
+	var document yaml.Node
+	if unmarshallError := yaml.Unmarshal(data, &document); unmarshallError != nil {
+		return config, yamlError(filename, unmarshallError)
+	}
+	positions.addYaml(filename, &document, offsets)
 	return config, nil
 }
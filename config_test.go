@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -20,10 +21,10 @@ func TestReadFromYamlConfig(t *testing.T) {
 	}
 	log.Printf("dryrun is %v", Configuration.DryRun)
 
-	if Configuration.Alerta.ReloadInterval != 60 {
+	if Configuration.Alerta.ReloadInterval != Duration(time.Minute) {
 		t.Fatalf("unexpected reload interval")
 	}
-	log.Printf("interval is %v", Configuration.Alerta.ReloadInterval*time.Second)
+	log.Printf("interval is %v", Configuration.Alerta.ReloadInterval)
 
 	log.Printf("channels: %v", Configuration.Channels)
 	if len(Configuration.Channels) != 3 {
@@ -46,4 +47,30 @@ func TestReadFromYamlConfig(t *testing.T) {
 	for rulename, rule := range Configuration.Rules {
 		log.Printf("rule[%v]: filter '%v', channels %v", rulename, rule.Filter, rule.Channels)
 	}
+
+	if len(Configuration.InhibitRules) != 1 {
+		t.Fatalf("expected 1 inhibit rule")
+	}
+	log.Printf("inhibit rules: %v", Configuration.InhibitRules)
+}
+
+func TestShippedConfigurationsAreValid(t *testing.T) {
+
+	files := make([]string, 0)
+	for _, pattern := range []string{"config/*.yml", "docker/*.yml"} {
+		matches, _ := filepath.Glob(pattern)
+		files = append(files, matches...)
+	}
+
+	for _, file := range files {
+		if filepath.Base(file) == "docker-compose.yml" {
+			continue
+		}
+		if _, err := Load(file); err != nil {
+			t.Errorf("invalid shipped configuration %v: %v", file, err)
+		}
+	}
+	if len(files) < 2 {
+		t.Fatalf("expected to find the shipped configurations, got %v", files)
+	}
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/emersion/go-msgauth/dkim"
+	"io/ioutil"
+	"strings"
+)
+
+// headers signed by default, when present in the message
+var defaultDkimHeaders = []string{"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID", "MIME-Version", "Content-Type"}
+
+// DkimSigner adds a DKIM-Signature header (rsa-sha256, relaxed/relaxed canonicalization) to outgoing mails
+type DkimSigner struct {
+	options dkim.SignOptions
+}
+
+// NewDkimSigner loads the PEM encoded (PKCS#1 or PKCS#8) RSA private key of the dkim settings
+func NewDkimSigner(settings Dkim) (*DkimSigner, error) {
+
+	if settings.Domain == "" || settings.Selector == "" || settings.PrivateKeyFile == "" {
+		return nil, errors.New("dkim signing requires a domain, selector and private_key_file")
+	}
+
+	raw, err := ioutil.ReadFile(settings.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New(fmt.Sprintf("no PEM encoded private key found in %v", settings.PrivateKeyFile))
+	}
+
+	var key *rsa.PrivateKey
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		var parsed interface{}
+		if parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				err = errors.New("only RSA keys are supported")
+			}
+		}
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid dkim private key %v: %v", settings.PrivateKeyFile, err))
+	}
+
+	headers := settings.Headers
+	if len(headers) == 0 {
+		headers = defaultDkimHeaders
+	}
+	if !containsFold(headers, "From") {
+		return nil, errors.New("the dkim headers must include the From header")
+	}
+	return &DkimSigner{options: dkim.SignOptions{
+		Domain:                 settings.Domain,
+		Selector:               settings.Selector,
+		Signer:                 key,
+		Hash:                   crypto.SHA256,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		HeaderKeys:             headers,
+	}}, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the message with a DKIM-Signature header prepended
+func (signer *DkimSigner) Sign(msg []byte) ([]byte, error) {
+	options := signer.options
+	var signed bytes.Buffer
+	if err := dkim.Sign(&signed, bytes.NewReader(msg), &options); err != nil {
+		return nil, err
+	}
+	return signed.Bytes(), nil
+}
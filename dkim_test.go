@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/emersion/go-msgauth/dkim"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDkimSignature(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, err := ioutil.TempFile("", "dkim-*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyFile.Name())
+	pem.Encode(keyFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	keyFile.Close()
+
+	signer, err := NewDkimSigner(Dkim{Domain: "example.com", Selector: "alerts", PrivateKeyFile: keyFile.Name()})
+	if err != nil {
+		t.Fatalf("cannot create dkim signer: %v", err)
+	}
+
+	channel := MailChannel{settings: Smtp{From: "alerta@example.com", FromName: "Alerta"}, To: []string{"ops@example.com"}}
+	var msg bytes.Buffer
+	channel.message("2 alerts on production", "<p>Alerts  are   open</p>\n\n", "Alerts are open\n").WriteTo(&msg)
+
+	signed, err := signer.Sign(msg.Bytes())
+	if err != nil {
+		t.Fatalf("cannot sign message: %v", err)
+	}
+	if err := verifyDkim(signed, &key.PublicKey); err != nil {
+		t.Fatalf("invalid dkim signature: %v\n%s", err, signed)
+	}
+
+	tampered := bytes.Replace(signed, []byte("2 alerts on production"), []byte("3 alerts on production"), 1)
+	if err := verifyDkim(tampered, &key.PublicKey); err == nil {
+		t.Fatalf("expected the signature of a tampered message to be invalid")
+	}
+
+	if _, err := NewDkimSigner(Dkim{Domain: "example.com", Selector: "alerts", PrivateKeyFile: keyFile.Name(), Headers: []string{"Subject"}}); err == nil {
+		t.Fatalf("expected an error for signed headers without From")
+	}
+}
+
+// verifies the DKIM signature of a message with an independent implementation, using the public key of the signer
+func verifyDkim(msg []byte, publicKey *rsa.PublicKey) error {
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	lookup := func(domain string) ([]string, error) {
+		if domain != "alerts._domainkey.example.com" {
+			return nil, fmt.Errorf("unexpected lookup of the dkim record of %v", domain)
+		}
+		return []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)}, nil
+	}
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(msg), &dkim.VerifyOptions{LookupTXT: lookup})
+	if err != nil {
+		return err
+	}
+	if len(verifications) != 1 || verifications[0].Domain != "example.com" {
+		return fmt.Errorf("expected one signature of example.com, got %v", verifications)
+	}
+	return verifications[0].Err
+}
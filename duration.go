@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a configured duration, a Go duration string like 30s, 5m or 1h30m, or a plain number of seconds
+type Duration time.Duration
+
+func (duration *Duration) UnmarshalYAML(value *yaml.Node) error {
+
+	var seconds float64
+	if err := value.Decode(&seconds); err == nil {
+		*duration = Duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	var text string
+	if err := value.Decode(&text); err != nil {
+		return err
+	}
+	if seconds, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err == nil {
+		*duration = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	parsed, err := time.ParseDuration(strings.TrimSpace(text))
+	if err != nil {
+		// a type error is reported with the other errors of the file, instead of aborting the decoding
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %v: invalid duration '%v', use e.g. 30s, 5m or 1h30m, or a number of seconds", value.Line, text)}}
+	}
+	*duration = Duration(parsed)
+	return nil
+}
+
+func (duration Duration) String() string {
+	return time.Duration(duration).String()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDurations(t *testing.T) {
+
+	tests := map[string]time.Duration{
+		"60":      time.Minute,
+		"'90'":    90 * time.Second,
+		"1.5":     1500 * time.Millisecond,
+		"30s":     30 * time.Second,
+		"5m":      5 * time.Minute,
+		"1h30m":   90 * time.Minute,
+		"'250ms'": 250 * time.Millisecond,
+	}
+	for value, expected := range tests {
+		var rule Rule
+		if err := yaml.Unmarshal([]byte("for: "+value), &rule); err != nil || time.Duration(rule.For) != expected {
+			t.Errorf("expected %v to be %v, got %v (%v)", value, expected, rule.For, err)
+		}
+	}
+}
+
+func TestInvalidDurationsAreReportedWithTheirLine(t *testing.T) {
+
+	err := loadTestConfig(t, `
+alerta:
+  endpoint: http://alerta:8080/api
+  reload_interval: 5 minutes
+`)
+	if expected := "config.yml:4: invalid duration '5 minutes'"; !strings.Contains(err, expected) {
+		t.Errorf("expected '%v', got %v", expected, err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"time"
+)
+
+// FlapDetector tracks open/close transitions of the alerts of a rule over a sliding window
+type FlapDetector struct {
+	settings Flapping
+
+	alerts      map[string]*flapState
+	initialized bool
+}
+
+type flapState struct {
+	alert          Alert
+	transitions    []time.Time
+	lastTransition time.Time
+	flapping       bool
+}
+
+func NewFlapDetector(settings Flapping) *FlapDetector {
+	return &FlapDetector{settings: settings, alerts: make(map[string]*flapState)}
+}
+
+func (detector *FlapDetector) enabled() bool {
+	return detector.settings.Threshold > 0
+}
+
+// Update records the transitions between the previously and currently open alerts. It returns the alerts
+// that started flapping, and the alerts that stopped flapping because they were stable long enough.
+func (detector *FlapDetector) Update(now time.Time, previous []Alert, current []Alert) ([]Alert, []Alert) {
+	started := make([]Alert, 0)
+	stabilized := make([]Alert, 0)
+
+	if !detector.enabled() {
+		return started, stabilized
+	}
+	if !detector.initialized {
+		// the first evaluation has no previous state, so there are no transitions yet
+		detector.initialized = true
+		return started, stabilized
+	}
+
+	for _, alert := range current {
+		if !Contains(alert, previous) {
+			detector.transition(now, alert)
+		} else if state, ok := detector.alerts[alert.Id]; ok {
+			state.alert = alert
+		}
+	}
+	for _, alert := range previous {
+		if !Contains(alert, current) {
+			detector.transition(now, alert)
+		}
+	}
+
+	window := time.Duration(detector.settings.Window)
+	stablePeriod := time.Duration(detector.settings.StablePeriod)
+
+	for id, state := range detector.alerts {
+		recent := make([]time.Time, 0, len(state.transitions))
+		for _, transition := range state.transitions {
+			if now.Sub(transition) <= window {
+				recent = append(recent, transition)
+			}
+		}
+		state.transitions = recent
+
+		if state.flapping {
+			if now.Sub(state.lastTransition) >= stablePeriod {
+				stabilized = append(stabilized, state.alert)
+				delete(detector.alerts, id)
+			}
+		} else if len(state.transitions) >= detector.settings.Threshold {
+			state.flapping = true
+			started = append(started, state.alert)
+		} else if len(state.transitions) == 0 {
+			delete(detector.alerts, id)
+		}
+	}
+	return started, stabilized
+}
+
+func (detector *FlapDetector) transition(now time.Time, alert Alert) {
+	state, ok := detector.alerts[alert.Id]
+	if !ok {
+		state = &flapState{}
+		detector.alerts[alert.Id] = state
+	}
+	state.alert = alert
+	state.transitions = append(state.transitions, now)
+	state.lastTransition = now
+}
+
+// IsFlapping returns true if notifications for this alert are suppressed because it is flapping
+func (detector *FlapDetector) IsFlapping(alert Alert) bool {
+	state, ok := detector.alerts[alert.Id]
+	return ok && state.flapping
+}
+
+// Partition splits the given alerts in alerts that are stable and alerts that are flapping
+func (detector *FlapDetector) Partition(alerts []Alert) ([]Alert, []Alert) {
+	stable := make([]Alert, 0)
+	flapping := make([]Alert, 0)
+	for _, alert := range alerts {
+		if detector.IsFlapping(alert) {
+			flapping = append(flapping, alert)
+		} else {
+			stable = append(stable, alert)
+		}
+	}
+	return stable, flapping
+}
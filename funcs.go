@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	// time zone database for the 'timezone' of channels on hosts without zoneinfo
+	_ "time/tzdata"
+)
+
+var (
+	markdownCode   = regexp.MustCompile("`([^`]+)`")
+	markdownBold   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	markdownItalic = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	markdownLink   = regexp.MustCompile(`\[([^\]]+)\]\(((?:https?://|mailto:)[^)\s]+)\)`)
+)
+
+// alertFuncs are the functions available in all mail and Slack templates, times are shown in the given location
+// and texts are translated to the given language
+func alertFuncs(location *time.Location, language string) map[string]interface{} {
+	if location == nil {
+		location = time.Local
+	}
+	return map[string]interface{}{
+		// translated text, formatted with the optional arguments: {{ T "There are %v new alert(s):" .NewAlertCount }}
+		"T": func(message string, args ...interface{}) string {
+			if len(args) == 0 {
+				return translate(language, message)
+			}
+			return translatef(language, message, args...)
+		},
+		// human readable duration, or the time elapsed since a time: {{ humanize .CreateTime }}
+		"humanize": func(value interface{}) (string, error) {
+			switch typed := value.(type) {
+			case time.Duration:
+				return humanizeDuration(typed), nil
+			case time.Time:
+				return humanizeDuration(time.Since(typed)), nil
+			default:
+				return "", fmt.Errorf("humanize expects a duration or a time, got %T", value)
+			}
+		},
+		"since": func(t time.Time) time.Duration {
+			return time.Since(t)
+		},
+		// {{ .CreateTime | formatTime "2006-01-02 15:04" }}
+		"formatTime": func(layout string, t time.Time) string {
+			return t.In(location).Format(layout)
+		},
+		"localTime": func(t time.Time) time.Time {
+			return t.In(location)
+		},
+		// {{ .Text | truncate 80 }}
+		"truncate": truncate,
+		"sortBySeverity": func(alerts []Alert) []Alert {
+			sorted := append(make([]Alert, 0, len(alerts)), alerts...)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				return severities.Rank(sorted[i].Severity) < severities.Rank(sorted[j].Severity)
+			})
+			return sorted
+		},
+		"countBySeverity": func(alerts []Alert) map[string]int {
+			counts := make(map[string]int)
+			for _, alert := range alerts {
+				counts[alert.Severity]++
+			}
+			return counts
+		},
+		// {{ range groupBy "environment" .NewAlerts }}{{ .Name }}: {{ len .Alerts }}{{ end }}
+		"groupBy": func(label string, alerts []Alert) []AlertGroup {
+			return GroupAlerts(alerts, []string{label})
+		},
+		// {{ .Service | join ", " }}
+		"join": func(separator string, values []string) string {
+			return strings.Join(values, separator)
+		},
+		"markdown": markdown,
+		"severityColor": func(severity string) string {
+			return (&Alert{Severity: severity}).Color()
+		},
+		"severityEmoji": severities.Emoji,
+		"severityName":  severities.DisplayName,
+		// true when the severity is as severe as the minimum severity, or more: {{ if atLeast .Severity "major" }}
+		"atLeast": severities.AtLeast,
+	}
+}
+
+// e.g. 45s, 12m, 3h 5m, 2d 4h
+func humanizeDuration(duration time.Duration) string {
+	if duration < 0 {
+		duration = -duration
+	}
+	days := int(duration.Hours()) / 24
+	hours := int(duration.Hours()) % 24
+	minutes := int(duration.Minutes()) % 60
+
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%vd %vh", days, hours)
+	case days > 0:
+		return fmt.Sprintf("%vd", days)
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%vh %vm", hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%vh", hours)
+	case minutes > 0:
+		return fmt.Sprintf("%vm", minutes)
+	default:
+		return fmt.Sprintf("%vs", int(duration.Seconds()))
+	}
+}
+
+// shortens text to at most length characters, ending with an ellipsis when truncated
+func truncate(length int, text string) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	if length < 1 {
+		return ""
+	}
+	return string(runes[:length-1]) + "…"
+}
+
+// converts the inline markdown of alert texts (bold, italic, code, links and line breaks) to html
+func markdown(text string) template.HTML {
+	escaped := template.HTMLEscapeString(text)
+	escaped = markdownCode.ReplaceAllString(escaped, "<code>$1</code>")
+	escaped = markdownLink.ReplaceAllString(escaped, `<a href="$2">$1</a>`)
+	escaped = markdownBold.ReplaceAllString(escaped, "<strong>$1</strong>")
+	escaped = markdownItalic.ReplaceAllString(escaped, "<em>$1$2</em>")
+	escaped = strings.Replace(escaped, "\n", "<br>\n", -1)
+	return template.HTML(escaped)
+}
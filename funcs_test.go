@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+	texttemplate "text/template"
+	"time"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+
+	brussels, _ := time.LoadLocation("Europe/Brussels")
+	alerts := []Alert{
+		{Resource: "web", Severity: "minor", Service: []string{"shop", "api"}, CreateTime: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{Resource: "db", Severity: "critical"},
+		{Resource: "cache", Severity: "minor"},
+	}
+
+	tests := map[string]string{
+		`{{ humanize .Duration }}`:                                                             "2d 3h",
+		`{{ range sortBySeverity .Alerts }}{{ .Resource }} {{ end }}`:                          "db web cache ",
+		`{{ with index .Alerts 0 }}{{ .CreateTime | formatTime "15:04 MST" }}{{ end }}`:        "12:00 CEST",
+		`{{ with index .Alerts 0 }}{{ .Service | join ", " }}{{ end }}`:                        "shop, api",
+		`{{ .Text | truncate 10 }}`:                                                            "Disk usag…",
+		`{{ index (countBySeverity .Alerts) "minor" }}`:                                        "2",
+		`{{ range groupBy "severity" .Alerts }}{{ .Name }}={{ len .Alerts }} {{ end }}`:        "critical=1 minor=2 ",
+		`{{ severityColor "critical" }} {{ severityEmoji "warning" }} {{ severityEmoji "x" }}`: "#dc3545 :warning: :grey_question:",
+	}
+	data := struct {
+		Alerts   []Alert
+		Duration time.Duration
+		Text     string
+	}{alerts, 51*time.Hour + 10*time.Minute, "Disk usage above 90%"}
+
+	for text, expected := range tests {
+		var result bytes.Buffer
+		tmpl := texttemplate.Must(texttemplate.New("test").Funcs(alertFuncs(brussels, "")).Parse(text))
+		if err := tmpl.Execute(&result, data); err != nil {
+			t.Fatalf("cannot execute '%v': %v", text, err)
+		}
+		if result.String() != expected {
+			t.Errorf("'%v' rendered '%v', expected '%v'", text, result.String(), expected)
+		}
+	}
+}
+
+func TestMarkdownFunc(t *testing.T) {
+
+	var result bytes.Buffer
+	tmpl := template.Must(template.New("test").Funcs(alertFuncs(nil, "")).Parse(`{{ markdown . }}`))
+	tmpl.Execute(&result, "**Disk** full on `db1`, see [runbook](https://wiki.example.com/disk)\n<script>")
+
+	expected := `<strong>Disk</strong> full on <code>db1</code>, see <a href="https://wiki.example.com/disk">runbook</a><br>` + "\n&lt;script&gt;"
+	if result.String() != expected {
+		t.Fatalf("unexpected markdown html:\n%v\nexpected:\n%v", result.String(), expected)
+	}
+}
@@ -3,8 +3,9 @@ module github.com/guanaco-io/notifications
 go 1.16
 
 require (
+	github.com/emersion/go-msgauth v0.6.5
 	github.com/slack-go/slack v0.9.1
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
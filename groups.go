@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// AlertGroup is a set of alerts with the same values for the group_by labels of a rule
+type AlertGroup struct {
+	Name   string
+	Labels map[string]string
+	Alerts []Alert
+
+	groupBy []string
+}
+
+// GroupAlerts groups alerts by the given labels, sorted by group name.
+// Without group_by labels all alerts end up in one unnamed group.
+func GroupAlerts(alerts []Alert, groupBy []string) []AlertGroup {
+
+	groups := make(map[string]*AlertGroup)
+	names := make([]string, 0)
+
+	for _, alert := range alerts {
+		name := GroupName(alert, groupBy)
+
+		group, ok := groups[name]
+		if !ok {
+			labels := make(map[string]string, len(groupBy))
+			for _, label := range groupBy {
+				labels[label] = alert.Label(label)
+			}
+			group = &AlertGroup{Name: name, Labels: labels, Alerts: make([]Alert, 0), groupBy: groupBy}
+			groups[name] = group
+			names = append(names, name)
+		}
+		group.Alerts = append(group.Alerts, alert)
+	}
+
+	sort.Strings(names)
+	result := make([]AlertGroup, len(names))
+	for index, name := range names {
+		result[index] = *groups[name]
+	}
+	return result
+}
+
+// GroupName joins the values of the group_by labels of the alert, e.g. "Production/webshop"
+func GroupName(alert Alert, groupBy []string) string {
+	values := make([]string, len(groupBy))
+	for index, label := range groupBy {
+		values[index] = alert.Label(label)
+	}
+	return strings.Join(values, "/")
+}
+
+// Filter returns the alerts that belong to this group
+func (group AlertGroup) Filter(alerts []Alert) []Alert {
+	result := make([]Alert, 0)
+	for _, alert := range alerts {
+		if GroupName(alert, group.groupBy) == group.Name {
+			result = append(result, alert)
+		}
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGroupAlertsByEnvironmentAndService(t *testing.T) {
+
+	alerts := []Alert{
+		{Id: "1", Environment: "Production", Service: []string{"webshop"}, Resource: "db"},
+		{Id: "2", Environment: "Production", Service: []string{"webshop"}, Resource: "web"},
+		{Id: "3", Environment: "Development", Service: []string{"webshop"}, Resource: "web"},
+	}
+
+	groups := GroupAlerts(alerts, []string{"environment", "service"})
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %v", groups)
+	}
+	if groups[1].Name != "Production/webshop" || len(groups[1].Alerts) != 2 {
+		t.Fatalf("unexpected group %v", groups[1])
+	}
+	if groups[1].Labels["environment"] != "Production" {
+		t.Fatalf("unexpected group labels %v", groups[1].Labels)
+	}
+
+	event := OpenAlertsEvent{Group: groups[1].Name, NewAlertCount: len(groups[1].Alerts), NewAlerts: groups[1].Alerts}
+	if subject := event.Subject(); subject != "2 alerts on Production/webshop" {
+		t.Fatalf("unexpected subject '%v'", subject)
+	}
+	if filtered := groups[0].Filter(alerts); len(filtered) != 1 || filtered[0].Id != "3" {
+		t.Fatalf("unexpected alerts in group %v: %v", groups[0].Name, filtered)
+	}
+}
+
+func TestGroupAlertsWithoutGroupBy(t *testing.T) {
+
+	groups := GroupAlerts([]Alert{{Id: "1"}, {Id: "2"}}, nil)
+
+	if len(groups) != 1 || groups[0].Name != "" || len(groups[0].Alerts) != 2 {
+		t.Fatalf("expected all alerts in one unnamed group, got %v", groups)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Message catalogs translate the built-in strings (subjects and template texts), keyed by their English text.
+// The catalogs are embedded in the binary, entries of locales/<language>.yml on disk override them.
+//
+//go:embed locales
+var defaultCatalogs embed.FS
+
+var catalogs = struct {
+	mutex    sync.Mutex
+	messages map[string]map[string]string
+}{messages: make(map[string]map[string]string)}
+
+// translate returns the translation of the message in the language, e.g. "nl-BE" falls back to "nl"
+// and untranslated messages are returned as is
+func translate(language string, message string) string {
+	for _, candidate := range languageCandidates(language) {
+		if translation, ok := catalog(candidate)[message]; ok {
+			return translation
+		}
+	}
+	return message
+}
+
+// translatef formats the translation of the message
+func translatef(language string, format string, args ...interface{}) string {
+	return fmt.Sprintf(translate(language, format), args...)
+}
+
+// the language followed by its base language, e.g. [nl-BE nl]
+func languageCandidates(language string) []string {
+	if language == "" {
+		return nil
+	}
+	candidates := []string{language}
+	if index := strings.IndexAny(language, "-_"); index > 0 {
+		candidates = append(candidates, language[:index])
+	}
+	return candidates
+}
+
+func catalog(language string) map[string]string {
+	catalogs.mutex.Lock()
+	defer catalogs.mutex.Unlock()
+
+	messages, ok := catalogs.messages[language]
+	if !ok {
+		messages = make(map[string]string)
+		filename := "locales/" + language + ".yml"
+		if raw, err := defaultCatalogs.ReadFile(filename); err == nil {
+			loadCatalog(filename, raw, messages)
+		}
+		if raw, err := ioutil.ReadFile(filename); err == nil {
+			loadCatalog(filename, raw, messages)
+		}
+		catalogs.messages[language] = messages
+	}
+	return messages
+}
+
+func loadCatalog(filename string, raw []byte, messages map[string]string) {
+	entries := make(map[string]string)
+	if err := yaml.Unmarshal(raw, &entries); err != nil {
+		log.Printf("Ignoring invalid message catalog %v: %v", filename, err)
+		return
+	}
+	for message, translation := range entries {
+		messages[message] = translation
+	}
+}
+
+// clearCatalogs drops the loaded catalogs, so they are read again on their next use
+func clearCatalogs() {
+	catalogs.mutex.Lock()
+	defer catalogs.mutex.Unlock()
+
+	catalogs.messages = make(map[string]map[string]string)
+}
+
+// true when there is a message catalog for the language
+func hasCatalog(language string) bool {
+	for _, candidate := range languageCandidates(language) {
+		if len(catalog(candidate)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// localizedTemplate returns the variant of the template for the language when there is one,
+// e.g. templates/open_alerts.nl.gohtml for templates/open_alerts.gohtml, or else the template itself
+func localizedTemplate(filename string, language string) string {
+	extension := path.Ext(filename)
+	for _, candidate := range languageCandidates(language) {
+		localized := strings.TrimSuffix(filename, extension) + "." + candidate + extension
+		if templates.exists(localized) {
+			return localized
+		}
+	}
+	return filename
+}
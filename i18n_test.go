@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranslations(t *testing.T) {
+
+	event := OpenAlertsEvent{NewAlertCount: 3, NewAlerts: readAlerts(t), Language: "nl-BE"}
+	if subject := event.Subject(); subject != "3 nieuwe alerts" {
+		t.Fatalf("expected dutch subject, got '%v'", subject)
+	}
+	event.Language = ""
+	if subject := event.Subject(); subject != "3 new alerts" {
+		t.Fatalf("expected english subject, got '%v'", subject)
+	}
+	if translation := translate("fr", "Regards,"); translation != "Regards," {
+		t.Fatalf("expected untranslated message without catalog, got '%v'", translation)
+	}
+
+	text, err := MailChannel{Language: "nl"}.renderText("templates/closed_alerts.gotxt", ClosedAlertsEvent{Alerts: readAlerts(t), Language: "nl"})
+	if err != nil {
+		t.Fatalf("cannot render template: %v", err)
+	}
+	if !strings.Contains(text, "3 alerts werden gesloten") || !strings.Contains(text, "Groetjes,") {
+		t.Fatalf("expected dutch mail:\n%v", text)
+	}
+}
+
+func TestLocalizedTemplateLookup(t *testing.T) {
+
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "open.gohtml")
+	ioutil.WriteFile(filename, []byte("{{ .Subject }}"), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "open.nl.gohtml"), []byte("Hallo, {{ .Subject }}"), 0644)
+
+	if localized := localizedTemplate(filename, "nl-BE"); localized != filepath.Join(directory, "open.nl.gohtml") {
+		t.Fatalf("expected dutch template, got %v", localized)
+	}
+	if localized := localizedTemplate(filename, "fr"); localized != filename {
+		t.Fatalf("expected default template, got %v", localized)
+	}
+
+	channel := MailChannel{TemplateOpen: filename, Language: "nl"}
+	body, err := channel.render(filename, OpenAlertsEvent{NewAlertCount: 2, NewAlerts: readAlerts(t), Language: "nl"})
+	if err != nil || body != "Hallo, 2 nieuwe alerts" {
+		t.Fatalf("unexpected localized body '%v' (%v)", body, err)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// loadIncludes merges the channels, rules, inhibit rules, smtp profiles and Slack workspaces of the included files into
+// the configuration. Includes are files, directories (all .yml and .yaml files in it) or glob patterns, relative to the
+// directory of the main configuration file. A channel, rule, profile or workspace can only be defined once.
+func loadIncludes(config *Config, filename string, positions configPositions) error {
+
+	files, err := includedFiles(config.Include, filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+
+	origins := newOrigins()
+	origins.add(*config, filename)
+
+	for _, file := range files {
+		// the inhibit rules of the file are appended to the ones merged before
+		included, err := parseConfig(file, positions, map[string]int{"inhibit_rules": len(config.InhibitRules)})
+		if err != nil {
+			return err
+		}
+		if err := checkIncluded(included, file); err != nil {
+			return err
+		}
+		if err := origins.conflicts(included, file); err != nil {
+			return err
+		}
+		origins.add(included, file)
+		mergeConfig(config, included)
+	}
+	return nil
+}
+
+// the files of the includes in order, the files of a directory or pattern sorted by name.
+// A file matched by more than one include is only included once, at its first match.
+func includedFiles(includes []string, directory string) ([]string, error) {
+
+	files := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(names []string) {
+		for _, name := range names {
+			if !seen[filepath.Clean(name)] {
+				seen[filepath.Clean(name)] = true
+				files = append(files, name)
+			}
+		}
+	}
+
+	for _, include := range includes {
+		pattern := include
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(directory, pattern)
+		}
+
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			entries, err := ioutil.ReadDir(pattern)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("cannot read included directory '%v': %v", include, err))
+			}
+			names := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				extension := strings.ToLower(filepath.Ext(entry.Name()))
+				if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && (extension == ".yml" || extension == ".yaml") {
+					names = append(names, filepath.Join(pattern, entry.Name()))
+				}
+			}
+			sort.Strings(names)
+			add(names)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid include '%v': %v", include, err))
+		}
+		if len(matches) == 0 && !strings.ContainsAny(include, "*?[") {
+			return nil, errors.New(fmt.Sprintf("included file '%v' does not exist", include))
+		}
+		sort.Strings(matches)
+		add(matches)
+	}
+	return files, nil
+}
+
+// included files only define channels, rules, inhibit rules, smtp profiles and Slack workspaces
+func checkIncluded(included Config, filename string) error {
+	global := []struct {
+		key string
+		set bool
+	}{
+		{"dry_run", included.DryRun},
+		{"workers", included.Workers != 0},
+		{"alerta", !reflect.DeepEqual(included.Alerta, Alerta{})},
+		{"channel_settings.slack", !reflect.DeepEqual(included.ChannelSettings.Slack, Slack{})},
+		{"channel_settings.smtp", !reflect.DeepEqual(included.ChannelSettings.Smtp, Smtp{})},
+		{"severities", len(included.Severities) > 0},
+		{"include", len(included.Include) > 0},
+	}
+	for _, setting := range global {
+		if setting.set {
+			return errors.New(fmt.Sprintf("%v: '%v' can only be configured in the main configuration file", filename, setting.key))
+		}
+	}
+	return nil
+}
+
+func mergeConfig(config *Config, included Config) {
+	if config.Channels == nil {
+		config.Channels = make(map[string]ChannelConfig)
+	}
+	for name, channel := range included.Channels {
+		config.Channels[name] = channel
+	}
+	if config.Rules == nil {
+		config.Rules = make(map[string]Rule)
+	}
+	for name, rule := range included.Rules {
+		config.Rules[name] = rule
+	}
+	if config.ChannelSettings.SmtpProfiles == nil {
+		config.ChannelSettings.SmtpProfiles = make(map[string]Smtp)
+	}
+	for name, profile := range included.ChannelSettings.SmtpProfiles {
+		config.ChannelSettings.SmtpProfiles[name] = profile
+	}
+	if config.ChannelSettings.SlackWorkspaces == nil {
+		config.ChannelSettings.SlackWorkspaces = make(map[string]Slack)
+	}
+	for name, workspace := range included.ChannelSettings.SlackWorkspaces {
+		config.ChannelSettings.SlackWorkspaces[name] = workspace
+	}
+	config.InhibitRules = append(config.InhibitRules, included.InhibitRules...)
+}
+
+// the file defining every channel, rule, smtp profile and Slack workspace, to report duplicates
+type origins map[string]map[string]string
+
+func newOrigins() origins {
+	return origins{"channel": {}, "rule": {}, "smtp profile": {}, "slack workspace": {}}
+}
+
+func (origins origins) names(config Config) map[string][]string {
+	names := make(map[string][]string)
+	for name := range config.Channels {
+		names["channel"] = append(names["channel"], name)
+	}
+	for name := range config.Rules {
+		names["rule"] = append(names["rule"], name)
+	}
+	for name := range config.ChannelSettings.SmtpProfiles {
+		names["smtp profile"] = append(names["smtp profile"], name)
+	}
+	for name := range config.ChannelSettings.SlackWorkspaces {
+		names["slack workspace"] = append(names["slack workspace"], name)
+	}
+	for _, list := range names {
+		sort.Strings(list)
+	}
+	return names
+}
+
+func (origins origins) add(config Config, filename string) {
+	for kind, names := range origins.names(config) {
+		for _, name := range names {
+			origins[kind][name] = filename
+		}
+	}
+}
+
+func (origins origins) conflicts(config Config, filename string) error {
+	for _, kind := range []string{"channel", "rule", "smtp profile", "slack workspace"} {
+		for _, name := range origins.names(config)[kind] {
+			if origin, ok := origins[kind][name]; ok {
+				return errors.New(fmt.Sprintf("%v '%v' of %v is already defined in %v", kind, name, filename, origin))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludedFilesAreMerged(t *testing.T) {
+
+	directory := t.TempDir()
+	os.Mkdir(filepath.Join(directory, "conf.d"), 0700)
+
+	write := func(name string, content string) {
+		if err := ioutil.WriteFile(filepath.Join(directory, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("config.yml", `
+alerta:
+  endpoint: http://alerta:8080/api
+  reload_interval: 60
+include:
+  - conf.d
+channels:
+  support:
+    type: mail
+    config:
+      to: support@example.com
+rules:
+  support:
+    channels: [support]
+`)
+	write("conf.d/webshop.yml", `
+channels:
+  webshop:
+    type: mail
+    config:
+      to: webshop@example.com
+rules:
+  webshop:
+    filter: service=webshop
+    channels: [webshop]
+inhibit_rules:
+  - source_match:
+      event: DatabaseDown
+`)
+	write("conf.d/marketing.yaml", `
+rules:
+  marketing:
+    channels: [webshop]
+`)
+	write("conf.d/README.md", "not a configuration file")
+
+	config, err := Load(filepath.Join(directory, "config.yml"))
+	if err != nil {
+		t.Fatalf("cannot load config: %v", err)
+	}
+	if len(config.Channels) != 2 || len(config.Rules) != 3 || len(config.InhibitRules) != 1 || config.Rules["webshop"].Filter != "service=webshop" {
+		t.Errorf("expected the channels and rules of all files, got %v, %v and %v", config.Channels, config.Rules, config.InhibitRules)
+	}
+
+	write("conf.d/duplicate.yml", `
+rules:
+  support:
+    channels: [webshop]
+`)
+	if _, err := Load(filepath.Join(directory, "config.yml")); err == nil || !strings.Contains(err.Error(), "rule 'support' of") || !strings.Contains(err.Error(), "config.yml") {
+		t.Errorf("expected duplicate rule error, got %v", err)
+	}
+
+	write("conf.d/duplicate.yml", `
+alerta:
+  endpoint: http://other:8080/api
+`)
+	if _, err := Load(filepath.Join(directory, "config.yml")); err == nil || !strings.Contains(err.Error(), "'alerta' can only be configured in the main configuration file") {
+		t.Errorf("expected error for alerta settings in an included file, got %v", err)
+	}
+
+	write("conf.d/duplicate.yml", `
+workers: 8
+`)
+	if _, err := Load(filepath.Join(directory, "config.yml")); err == nil || !strings.Contains(err.Error(), "'workers' can only be configured in the main configuration file") {
+		t.Errorf("expected error for workers in an included file, got %v", err)
+	}
+}
+
+func TestFilesMatchedByMoreIncludesAreIncludedOnce(t *testing.T) {
+
+	directory := t.TempDir()
+	os.Mkdir(filepath.Join(directory, "conf.d"), 0700)
+	ioutil.WriteFile(filepath.Join(directory, "conf.d", "a.yml"), []byte("rules: {}"), 0600)
+	ioutil.WriteFile(filepath.Join(directory, "conf.d", "b.yml"), []byte("rules: {}"), 0600)
+
+	files, err := includedFiles([]string{"conf.d/b.yml", "conf.d", "./conf.d/*.yml"}, directory)
+	if err != nil {
+		t.Fatalf("cannot resolve includes: %v", err)
+	}
+	expected := []string{filepath.Join(directory, "conf.d", "b.yml"), filepath.Join(directory, "conf.d", "a.yml")}
+	if strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v, got %v", expected, files)
+	}
+}
+
+func TestPositionsOfIncludedInhibitRules(t *testing.T) {
+
+	directory := t.TempDir()
+	ioutil.WriteFile(filepath.Join(directory, "config.yml"), []byte(`
+alerta:
+  endpoint: http://alerta:8080/api
+  reload_interval: 60
+include:
+  - inhibit.yml
+inhibit_rules:
+  - source_match:
+      event: NodeDown
+`), 0600)
+	ioutil.WriteFile(filepath.Join(directory, "inhibit.yml"), []byte(`
+inhibit_rules:
+  - source_match:
+      event: DatabaseDown
+  - target_match:
+      event: QueryFailed
+`), 0600)
+
+	_, err := Load(filepath.Join(directory, "config.yml"))
+	expected := filepath.Join(directory, "inhibit.yml") + ":5: inhibit_rules[2]: source_match is required"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected %v, got %v", expected, err)
+	}
+}
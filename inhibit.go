@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+)
+
+// Inhibitor suppresses notifications for alerts that are caused by another open alert,
+// based on the inhibit rules and all alerts fetched during one evaluation cycle
+type Inhibitor struct {
+	rules  []InhibitRule
+	alerts []Alert
+}
+
+func NewInhibitor(rules []InhibitRule, fetched ...[]Alert) Inhibitor {
+
+	alerts := make([]Alert, 0)
+	for _, ruleAlerts := range fetched {
+		for _, alert := range ruleAlerts {
+			if !Contains(alert, alerts) {
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+	return Inhibitor{rules: rules, alerts: alerts}
+}
+
+// InhibitedBy returns the open source alert that inhibits the given alert, if any
+func (inhibitor Inhibitor) InhibitedBy(alert Alert) (Alert, bool) {
+	for _, rule := range inhibitor.rules {
+		if !Matches(alert, rule.TargetMatch) {
+			continue
+		}
+		for _, source := range inhibitor.alerts {
+			if source.Id != alert.Id && Matches(source, rule.SourceMatch) && equalLabels(source, alert, rule.Equal) {
+				return source, true
+			}
+		}
+	}
+	return Alert{}, false
+}
+
+// Partition splits the given alerts in alerts that are not inhibited and alerts that are inhibited
+func (inhibitor Inhibitor) Partition(alerts []Alert) ([]Alert, []Alert) {
+	active := make([]Alert, 0)
+	inhibited := make([]Alert, 0)
+	for _, alert := range alerts {
+		if _, ok := inhibitor.InhibitedBy(alert); ok {
+			inhibited = append(inhibited, alert)
+		} else {
+			active = append(active, alert)
+		}
+	}
+	return active, inhibited
+}
+
+// Matches checks all matchers against the alert labels. A value starting with '!' negates the match,
+// multi valued labels like service match when one of their values matches.
+func Matches(alert Alert, matchers map[string]string) bool {
+	for name, expected := range matchers {
+		negate := strings.HasPrefix(expected, "!")
+		if negate {
+			expected = expected[1:]
+		}
+		if matchesLabel(alert, name, expected) == negate {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesLabel(alert Alert, name string, expected string) bool {
+	if name == "service" {
+		for _, service := range alert.Service {
+			if service == expected {
+				return true
+			}
+		}
+		return false
+	}
+	return alert.Label(name) == expected
+}
+
+func equalLabels(source Alert, target Alert, names []string) bool {
+	for _, name := range names {
+		if source.Label(name) != target.Label(name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInhibitAlertsWithSameEnvironment(t *testing.T) {
+
+	rules := []InhibitRule{{
+		SourceMatch: map[string]string{"event": "DatabaseDown"},
+		TargetMatch: map[string]string{"severity": "!critical"},
+		Equal:       []string{"environment"},
+	}}
+
+	database := Alert{Id: "1", Environment: "Production", Event: "DatabaseDown", Severity: "critical"}
+	webshop := Alert{Id: "2", Environment: "Production", Event: "HttpError", Severity: "major"}
+	critical := Alert{Id: "3", Environment: "Production", Event: "DiskFull", Severity: "critical"}
+	acceptance := Alert{Id: "4", Environment: "Acceptance", Event: "HttpError", Severity: "major"}
+
+	inhibitor := NewInhibitor(rules, []Alert{database}, []Alert{webshop, critical, acceptance})
+
+	active, inhibited := inhibitor.Partition([]Alert{database, webshop, critical, acceptance})
+
+	if len(inhibited) != 1 || inhibited[0].Id != webshop.Id {
+		t.Fatalf("expected only alert %v to be inhibited, got %v", webshop.Id, inhibited)
+	}
+	if len(active) != 3 {
+		t.Fatalf("expected 3 active alerts, got %v", active)
+	}
+	if source, ok := inhibitor.InhibitedBy(webshop); !ok || source.Id != database.Id {
+		t.Fatalf("expected alert %v to be inhibited by %v", webshop.Id, database.Id)
+	}
+}
+
+func TestMatchesMultiValuedService(t *testing.T) {
+
+	alert := Alert{Service: []string{"servicemix", "tilroy"}, Environment: "Production"}
+
+	if !Matches(alert, map[string]string{"service": "tilroy", "environment": "Production"}) {
+		t.Fatalf("expected alert to match service tilroy")
+	}
+	if Matches(alert, map[string]string{"service": "!tilroy"}) {
+		t.Fatalf("expected alert not to match negated service tilroy")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+const shelveTimeout = 3600
+
+// Slack interaction payloads are small, larger requests are rejected before their signature is verified
+const maxInteractionSize = 1 << 20
+
+// Alerta actions of the Slack buttons, by action id
+var slackActions = map[string]struct {
+	action  string
+	label   string
+	timeout int
+}{
+	"ack":    {"ack", "Acknowledged", 0},
+	"shelve": {"shelve", "Shelved for 1h", shelveTimeout},
+	"close":  {"close", "Closed", 0},
+}
+
+// alertActions returns the buttons to act on an alert from Slack, the block id refers to the alert
+func alertActions(alert Alert) *slack.ActionBlock {
+	button := func(actionId string, text string) *slack.ButtonBlockElement {
+		return slack.NewButtonBlockElement(actionId, alert.Id, slack.NewTextBlockObject(slack.PlainTextType, text, false, false))
+	}
+	open := button("open", "Open in Alerta")
+	open.URL = alert.Url
+
+	return slack.NewActionBlock(
+		alert.Id,
+		button("ack", "Ack").WithStyle(slack.StylePrimary),
+		button("shelve", "Shelve 1h"),
+		button("close", "Close").WithStyle(slack.StyleDanger),
+		open,
+	)
+}
+
+// InteractionHandler receives the button clicks of Slack messages and performs the matching Alerta action.
+// Workspaces sharing the same endpoint are told apart by their signing secret.
+type InteractionHandler struct {
+	workspaces []Slack
+	alerta     AlertaClient
+	dryRun     bool
+}
+
+// ListenForInteractions starts an http server for every listen address of the interactive Slack workspaces
+func ListenForInteractions(workspaces []Slack, alerta AlertaClient, dryRun bool) {
+
+	handlers := make(map[string]map[string][]Slack)
+	for _, settings := range workspaces {
+		if !settings.Interactive() {
+			continue
+		}
+		listen := settings.Interactions.Listen
+		path := getOrElse(settings.Interactions.Path, "/slack/interactions")
+		if _, ok := handlers[listen]; !ok {
+			handlers[listen] = make(map[string][]Slack)
+		}
+		handlers[listen][path] = append(handlers[listen][path], settings)
+	}
+
+	for listen, paths := range handlers {
+		mux := http.NewServeMux()
+		for path, settings := range paths {
+			log.Printf("Listening for Slack interactions on %v%v", listen, path)
+			mux.Handle(path, InteractionHandler{workspaces: settings, alerta: alerta, dryRun: dryRun})
+		}
+
+		go func(listen string, mux *http.ServeMux) {
+			err := http.ListenAndServe(listen, mux)
+			log.Fatalf("Error listening for Slack interactions: %v", err)
+		}(listen, mux)
+	}
+}
+
+func (handler InteractionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	body, readError := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxInteractionSize))
+	if readError != nil && len(body) >= maxInteractionSize {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if readError != nil {
+		http.Error(w, readError.Error(), http.StatusBadRequest)
+		return
+	}
+	settings, verifyError := handler.verify(r.Header, body)
+	if verifyError != nil {
+		log.Printf("Rejected Slack interaction: %v", verifyError)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var callback slack.InteractionCallback
+	form, parseError := url.ParseQuery(string(body))
+	if parseError == nil {
+		parseError = json.Unmarshal([]byte(form.Get("payload")), &callback)
+	}
+	if parseError != nil {
+		log.Printf("Error parsing Slack interaction: %v", parseError)
+		http.Error(w, parseError.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, blockAction := range callback.ActionCallback.BlockActions {
+		action, ok := slackActions[blockAction.ActionID]
+		if !ok {
+			// e.g. the 'Open in Alerta' link button
+			continue
+		}
+
+		user := slackUser(settings, callback.User)
+		text := fmt.Sprintf("%v by %v via Slack", action.label, user)
+		log.Printf("Slack user %v (%v) performs '%v' on alert %v", user, callback.User.ID, action.action, blockAction.Value)
+
+		if actionError := handler.alerta.action(blockAction.Value, action.action, text, action.timeout, handler.dryRun); actionError != nil {
+			log.Printf("Error performing Slack action '%v' on alert %v: %v", action.action, blockAction.Value, actionError)
+			text = fmt.Sprintf(":warning: %v could not %v the alert: %v", user, action.action, actionError)
+		}
+
+		if updateError := handler.updateMessage(settings, callback, blockAction.Value, text); updateError != nil {
+			log.Printf("Error updating Slack message after action '%v': %v", action.action, updateError)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// returns the settings of the workspace whose signing secret matches the request signature
+func (handler InteractionHandler) verify(header http.Header, body []byte) (Slack, error) {
+	var err error
+	for _, settings := range handler.workspaces {
+		var verifier slack.SecretsVerifier
+		if verifier, err = slack.NewSecretsVerifier(header, string(settings.SigningSecret)); err != nil {
+			return settings, err
+		}
+		if _, err = verifier.Write(body); err != nil {
+			return settings, err
+		}
+		if err = verifier.Ensure(); err == nil {
+			return settings, nil
+		}
+	}
+	return Slack{}, err
+}
+
+// name of the Slack user in the Alerta history, mapped with the configured users
+func slackUser(settings Slack, user slack.User) string {
+	if name, ok := settings.Interactions.Users[user.ID]; ok {
+		return name
+	}
+	return getOrElse(user.Name, user.ID)
+}
+
+// replaces the status line of the alert in the original message with who did what
+func (handler InteractionHandler) updateMessage(settings Slack, callback slack.InteractionCallback, alertId string, text string) error {
+
+	status := slack.NewContextBlock("status-"+alertId, slack.NewTextBlockObject(slack.MarkdownType, text, false, false))
+
+	// the buttons of the alert are either in the message blocks or in the blocks of an attachment
+	blocks := withStatus(callback.Message.Blocks.BlockSet, alertId, status)
+	attachments := callback.Message.Attachments
+	for index, attachment := range attachments {
+		attachments[index].Blocks = slack.Blocks{BlockSet: withStatus(attachment.Blocks.BlockSet, alertId, status)}
+	}
+	msg := slack.WebhookMessage{Text: callback.Message.Text, Attachments: attachments}
+	if len(blocks) > 0 {
+		msg.Blocks = &slack.Blocks{BlockSet: blocks}
+	}
+
+	if handler.dryRun {
+		log.Print("-- DryRun is active: not really updating slack message --")
+		return logSlackMessage(msg)
+	}
+
+	options := append(messageOptions(msg), slack.MsgOptionReplaceOriginal(callback.ResponseURL))
+	_, _, err := slack.New(string(settings.Token)).PostMessage(callback.Channel.ID, options...)
+	return err
+}
+
+// replaces the previous status of an alert, or adds it after the buttons of the alert
+func withStatus(blocks []slack.Block, alertId string, status *slack.ContextBlock) []slack.Block {
+	result := make([]slack.Block, 0, len(blocks)+1)
+	for _, block := range blocks {
+		if previous, ok := block.(*slack.ContextBlock); ok && previous.BlockID == status.BlockID {
+			continue
+		}
+		result = append(result, block)
+		if actions, ok := block.(*slack.ActionBlock); ok && actions.BlockID == alertId {
+			result = append(result, status)
+		}
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackInteractionAcknowledgesAlert(t *testing.T) {
+
+	var alertaRequest, slackRequest string
+	alerta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		alertaRequest = fmt.Sprintf("%v %v %v", r.Method, r.URL.Path, string(body))
+		fmt.Fprint(w, `{"status": "ok"}`)
+	}))
+	defer alerta.Close()
+	responseUrl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		slackRequest = string(body)
+		fmt.Fprint(w, `{"ok": true}`)
+	}))
+	defer responseUrl.Close()
+
+	settings := Slack{SigningSecret: "secret", Interactions: SlackInteractions{Listen: ":0", Users: map[string]string{"U1": "alice"}}}
+	other := Slack{SigningSecret: "other secret", Interactions: SlackInteractions{Listen: ":0"}}
+	handler := InteractionHandler{workspaces: []Slack{other, settings}, alerta: AlertaClient{config: Alerta{Endpoint: alerta.URL}}}
+
+	payload := fmt.Sprintf(`{"type": "block_actions", "user": {"id": "U1", "name": "alice.slack"}, "response_url": "%v",
+		"message": {"text": "New alert", "attachments": [{"blocks": [{"type": "actions", "block_id": "42", "elements": []}]}]},
+		"actions": [{"action_id": "ack", "block_id": "42", "value": "42", "type": "button"}]}`, responseUrl.URL)
+	body := url.Values{"payload": {payload}}.Encode()
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, signedRequest(body, "secret"))
+	if response.Code != http.StatusOK {
+		t.Fatalf("unexpected response %v: %v", response.Code, response.Body.String())
+	}
+	if !strings.HasPrefix(alertaRequest, "PUT /alert/42/action") || !strings.Contains(alertaRequest, `"action":"ack"`) || !strings.Contains(alertaRequest, "Acknowledged by alice via Slack") {
+		t.Fatalf("unexpected alerta request: %v", alertaRequest)
+	}
+	if !strings.Contains(slackRequest, "Acknowledged by alice via Slack") || !strings.Contains(slackRequest, `"replace_original":true`) {
+		t.Fatalf("unexpected slack message update: %v", slackRequest)
+	}
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, signedRequest(body, "wrong secret"))
+	if response.Code != http.StatusUnauthorized {
+		t.Fatalf("expected request with invalid signature to be rejected, got %v", response.Code)
+	}
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, signedRequest(strings.Repeat("x", maxInteractionSize+1), "secret"))
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected a too large request to be rejected, got %v", response.Code)
+	}
+}
+
+func signedRequest(body string, secret string) *http.Request {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	request := httptest.NewRequest("POST", "/slack/interactions", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	request.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return request
+}
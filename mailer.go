@@ -1,95 +1,70 @@
 package main
 
 import (
-	"fmt"
+	"bytes"
 	"gopkg.in/gomail.v2"
 	"log"
-	"net/mail"
-	"net/smtp"
-	"strings"
 )
 
-func (channel MailChannel) Send(subject string, body string, dryrun bool) error {
+func (channel MailChannel) Send(subject string, body string, text string, dryrun bool) error {
 
 	if dryrun {
 		log.Print("-- DryRun is active: not really sending mail --")
-		log.Printf("Generated mail from %v to %v [%v] \n%v", channel.settings.From, channel.To, subject, body)
+		log.Printf("Generated mail from %v to %v [%v] \n%v\n\n%v", channel.settings.From, channel.To, subject, text, body)
 
 		return nil
 	} else {
-		log.Printf("Sending smtp mail: %v", subject)
+		log.Printf("Sending mail with %v: %v", channel.settings.transport(), subject)
 
-		if !channel.settings.Anonymous {
-
-			m := gomail.NewMessage()
-			m.SetHeader("From", channel.settings.From)
-			m.SetHeader("To", channel.To...)
-			m.SetHeader("Subject", subject)
-			m.SetBody("text/html", body)
-
-			d := gomail.NewDialer(channel.settings.Server, channel.settings.Port, channel.settings.User, channel.settings.Password)
-			d.SSL = channel.settings.Ssl
+		var msg bytes.Buffer
+		if _, err := channel.message(subject, body, text).WriteTo(&msg); err != nil {
+			return err
+		}
 
-			return d.DialAndSend(m)
-		} else {
-			// inspired by https://gadelkareem.com/2018/05/03/golang-send-mail-without-authentication-using-localhost-sendmail-or-postfix/
-			to := make([]string, 0)
-			for _, destination := range channel.To {
-				to = append(to, (&mail.Address{"", destination}).String())
+		raw := msg.Bytes()
+		if channel.signer != nil {
+			var err error
+			if raw, err = channel.signer.Sign(raw); err != nil {
+				return err
 			}
-			return SendAnonymous(
-				fmt.Sprintf("%s:%d", channel.settings.Server, channel.settings.Port),
-				(&mail.Address{Name: channel.settings.FromName, Address: channel.settings.From}).String(),
-				subject,
-				body,
-				to,
-			)
 		}
-	}
-}
-
-func SendAnonymous(addr, from, subject, body string, to []string) error {
-	r := strings.NewReplacer("\r\n", "", "\r", "", "\n", "", "%0a", "", "%0d", "")
 
-	c, err := smtp.Dial(addr)
-	if err != nil {
-		return err
-	}
-	defer c.Close()
-	if err = c.Mail(r.Replace(from)); err != nil {
-		return err
-	}
-	for i := range to {
-		to[i] = r.Replace(to[i])
-		if err = c.Rcpt(to[i]); err != nil {
-			return err
+		switch channel.settings.transport() {
+		case TransportSendmail:
+			return sendmail(channel.settings, channel.settings.From, channel.recipients(), raw)
+		case TransportFile:
+			return writeMailFile(channel.settings.Directory, raw)
+		case TransportMaildir:
+			return writeMaildir(channel.settings.Directory, raw)
+		default:
+			return channel.pool.Send(channel.settings, channel.settings.From, channel.recipients(), raw)
 		}
 	}
+}
 
-	w, err := c.Data()
-	if err != nil {
-		return err
-	}
-
-	header := make(map[string]string)
-	header["To"] = strings.Join(to, ",")
-	header["From"] = from
-	header["Subject"] = subject
-	header["Content-Type"] = `text/html; charset="UTF-8"`
-
-	msg := ""
-	for k, v := range header {
-		msg += fmt.Sprintf("%s: %s\r\n", k, v)
+// multipart/alternative message with the plain text and the html version of the body
+func (channel MailChannel) message(subject string, body string, text string) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", channel.settings.From, channel.settings.FromName)
+	m.SetHeader("To", channel.To...)
+	if len(channel.Cc) > 0 {
+		m.SetHeader("Cc", channel.Cc...)
 	}
-	msg += "\r\n" + body
-
-	_, err = w.Write([]byte(msg))
-	if err != nil {
-		return err
+	if len(channel.Bcc) > 0 {
+		m.SetHeader("Bcc", channel.Bcc...)
 	}
-	err = w.Close()
-	if err != nil {
-		return err
+	if channel.ReplyTo != "" {
+		m.SetHeader("Reply-To", channel.ReplyTo)
 	}
-	return c.Quit()
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/plain", text)
+	m.AddAlternative("text/html", body)
+	return m
+}
+
+// all recipients of the mail, including cc and bcc
+func (channel MailChannel) recipients() []string {
+	recipients := append(make([]string, 0), channel.To...)
+	recipients = append(recipients, channel.Cc...)
+	return append(recipients, channel.Bcc...)
 }
@@ -3,7 +3,6 @@ package main
 import (
 	"log"
 	"os"
-	"strings"
 	"time"
 )
 
@@ -13,8 +12,14 @@ const (
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "preview" {
+		Preview(os.Args[2:])
+		return
+	}
+
 	if len(os.Args) != 2 {
 		log.Printf("Usage: notifications <config.yml>")
+		log.Printf("       notifications preview [-listen localhost:8090] [-alerts alerts.json] <config.yml>")
 		log.Fatal("  <config.yml> parameter is missing!")
 	}
 	log.Printf("Starting Guanaco notifications app with config file %v", os.Args[1])
@@ -23,35 +28,22 @@ func main() {
 	logFatal("Error initializing program", initError)
 	log.Printf("Configuration loaded successfully")
 
+	logFatal("Error loading severities", LoadSeverities(config))
+
 	channels, channelsError := LoadChannels(config)
 	logFatal("Error loading channels configuration", channelsError)
 	log.Printf("%v Channels loaded successfully", len(channels))
 
 	client := AlertaClient{config: config.Alerta}
-	ticker := time.NewTicker(config.Alerta.ReloadInterval * time.Second)
-
-	log.Printf("Waiting for %v before fetching alerts", config.Alerta.ReloadInterval*time.Second)
-
-	ruleHandlers := make([]RuleHandler, 0)
-	for ruleName, rule := range config.Rules {
-		if strings.Trim(ruleName, " ") != "" {
-			ruleHandlers = append(ruleHandlers, RuleHandler{client, ruleName, rule, channels, nil, config.DryRun})
-		}
-	}
 
-	go func() {
-		for t := range ticker.C {
+	ListenForInteractions(config.ChannelSettings.AllSlack(), client, config.DryRun)
 
-			for i, handler := range ruleHandlers {
-				handler.handle(t)
-				ruleHandlers[i] = handler
-			}
-		}
-	}()
+	scheduler := NewScheduler(config, client, channels)
+	scheduler.Start()
 
 	time.Sleep(maxDuration) // TODO find a better way to block here
-	ticker.Stop()
-	log.Println("Ticker stopped, exiting program")
+	scheduler.Stop()
+	log.Println("Scheduler stopped, exiting program")
 
 	os.Exit(0)
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// reloads the preview page when the fingerprint of the templates changes
+const previewReloadScript = `<script>
+(function () {
+    var fingerprint = null;
+    setInterval(function () {
+        fetch("/changes").then(function (response) { return response.text(); }).then(function (text) {
+            if (fingerprint !== null && text !== fingerprint) { location.reload(); }
+            fingerprint = text;
+        });
+    }, 1000);
+})();
+</script>`
+
+var previewIndex = template.Must(template.New("index").Parse(`<html>
+<head><title>Notification previews</title></head>
+<body>
+<h1>Notification previews</h1>
+<p>Alerts: {{ .Source }}</p>
+<table cellpadding="4">
+{{- range .Channels }}
+    <tr>
+        <td><strong>{{ .Name }}</strong></td>
+        {{- $channel := .Name }}{{ $views := .Views }}
+        {{- range $event := $.Events }}
+        <td>{{ $event }}:{{ range $views }} <a href="/render?channel={{ $channel }}&event={{ $event }}&view={{ . }}{{ $.RuleParameter }}">{{ . }}</a>{{ end }}</td>
+        {{- end }}
+    </tr>
+{{- end }}
+</table>
+</body>
+</html>`))
+
+// PreviewServer renders the templates of the configured channels against sample alerts, so templates can be designed
+// without waiting for a real alert. Templates are read again for every preview and the page reloads when they change.
+type PreviewServer struct {
+	config     Config
+	channels   map[string]Channel
+	alerta     AlertaClient
+	alertsFile string
+}
+
+// Preview starts the preview server, e.g. notifications preview -alerts test/alerts.json config/config.yml
+func Preview(args []string) {
+
+	flags := flag.NewFlagSet("preview", flag.ExitOnError)
+	listen := flags.String("listen", "localhost:8090", "listen address of the preview server")
+	alertsFile := flags.String("alerts", "", "json file with the alerts, like the response of the Alerta /alerts api (default: fetch the alerts of the rule from Alerta)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: notifications preview [-listen localhost:8090] [-alerts alerts.json] <config.yml>")
+	}
+
+	config, configError := Load(flags.Arg(0))
+	logFatal("Error initializing program", configError)
+	logFatal("Error loading severities", LoadSeverities(config))
+	channels, channelsError := LoadChannels(config)
+	logFatal("Error loading channels configuration", channelsError)
+
+	server := PreviewServer{config: config, channels: channels, alerta: AlertaClient{config: config.Alerta}, alertsFile: *alertsFile}
+
+	log.Printf("Previewing the templates of %v channels on http://%v", len(channels), *listen)
+	log.Fatal(http.ListenAndServe(*listen, server.Handler()))
+}
+
+func (server PreviewServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", server.index)
+	mux.HandleFunc("/render", server.render)
+	mux.HandleFunc("/changes", server.changes)
+	return mux
+}
+
+func (server PreviewServer) index(w http.ResponseWriter, r *http.Request) {
+
+	type channelViews struct {
+		Name  string
+		Views []string
+	}
+	names := make([]string, 0, len(server.channels))
+	for name := range server.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	channels := make([]channelViews, 0, len(names))
+	for _, name := range names {
+		switch previewTarget(server.channels[name]).(type) {
+		case MailChannel:
+			channels = append(channels, channelViews{name, []string{"html", "text", "subject"}})
+		case SlackChannel:
+			channels = append(channels, channelViews{name, []string{"slack"}})
+		}
+	}
+
+	source := server.alertsFile
+	ruleParameter := ""
+	if rule := r.URL.Query().Get("rule"); rule != "" {
+		ruleParameter = "&rule=" + url.QueryEscape(rule)
+		if source == "" {
+			source = "Alerta, rule " + rule
+		}
+	}
+	if source == "" {
+		source = "Alerta, add ?rule=<name> to select the rule (default: all open alerts)"
+	}
+
+	data := map[string]interface{}{
+		"Source":        source,
+		"Channels":      channels,
+		"Events":        []string{"open", "closed", "flapping", "severity", "storm"},
+		"RuleParameter": template.URL(ruleParameter),
+	}
+	if err := previewIndex.Execute(w, data); err != nil {
+		log.Printf("Error rendering preview index: %v", err)
+	}
+}
+
+func (server PreviewServer) render(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+	channel, ok := server.channels[query.Get("channel")]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown channel '%v'", query.Get("channel")), http.StatusNotFound)
+		return
+	}
+
+	// templates and catalogs are read again, so changes show up without a restart
+	templates.clear()
+	clearCatalogs()
+
+	rule := server.config.Rules[query.Get("rule")]
+	alerts, alertsError := server.alerts(rule)
+	if alertsError != nil {
+		http.Error(w, alertsError.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(alerts) == 0 {
+		http.Error(w, "there are no alerts to preview", http.StatusNotFound)
+		return
+	}
+
+	var output string
+	var renderError error
+	var html bool
+
+	switch target := previewTarget(channel).(type) {
+	case MailChannel:
+		event := previewEvent(query.Get("event"), alerts, rule, server.alerta.alertsUrl(rule), target.Language)
+		subject, body, text, err := target.renderMail(event)
+		renderError = err
+		switch query.Get("view") {
+		case "text":
+			output = text
+		case "subject":
+			output = subject
+		default:
+			output, html = body, true
+		}
+	case SlackChannel:
+		event := previewEvent(query.Get("event"), alerts, rule, server.alerta.alertsUrl(rule), target.Language)
+		msg, err := event.(slackEvent).toWebhookMessage(target)
+		renderError = err
+		raw, _ := json.MarshalIndent(msg, "", "  ")
+		output = string(raw)
+	default:
+		http.Error(w, "channel can't be previewed", http.StatusBadRequest)
+		return
+	}
+
+	// text, subjects and Slack json are shown as preformatted text, all previews get the reload script
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if renderError != nil {
+		fmt.Fprintf(w, `<pre style="color: #dc3545">%v</pre>`, template.HTMLEscapeString(renderError.Error()))
+	}
+	if html {
+		fmt.Fprint(w, output, previewReloadScript)
+	} else {
+		fmt.Fprintf(w, "<pre>%v</pre>%v", template.HTMLEscapeString(output), previewReloadScript)
+	}
+}
+
+// fingerprint of the modification times of the templates and catalogs, the preview page reloads when it changes
+func (server PreviewServer) changes(w http.ResponseWriter, r *http.Request) {
+
+	files := make([]string, 0)
+	for _, directory := range []string{"templates", "locales"} {
+		matches, _ := filepath.Glob(filepath.Join(directory, "*"))
+		files = append(files, matches...)
+	}
+	for _, channel := range server.config.Channels {
+		for key, value := range channel.Config {
+			if strings.HasPrefix(key, "template_") {
+				matches, _ := filepath.Glob(strings.TrimSuffix(value, filepath.Ext(value)) + "*" + filepath.Ext(value))
+				files = append(files, matches...)
+			}
+		}
+	}
+
+	var lastModified int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().UnixNano() > lastModified {
+			lastModified = info.ModTime().UnixNano()
+		}
+	}
+	fmt.Fprintf(w, "%v-%v", len(files), lastModified)
+}
+
+// the alerts of the alerts file, or the alerts of the rule in Alerta
+func (server PreviewServer) alerts(rule Rule) ([]Alert, error) {
+
+	if server.alertsFile == "" {
+		return server.alerta.searchAlerts(rule), nil
+	}
+
+	var alertsResponse AlertsResponse
+	raw, err := ioutil.ReadFile(server.alertsFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &alertsResponse); err != nil {
+		return nil, errors.New(fmt.Sprintf("cannot parse alerts file %v: %v", server.alertsFile, err))
+	}
+	for index, alert := range alertsResponse.Alerts {
+		alertsResponse.Alerts[index].Url = fmt.Sprintf("%v/#/alert/%v", server.config.Alerta.Webui, alert.Id)
+	}
+	return alertsResponse.Alerts, nil
+}
+
+// the mail or Slack channel behind rate limits and the Slack app
+func previewTarget(channel Channel) Channel {
+	switch typed := channel.(type) {
+	case LimitedChannel:
+		return previewTarget(typed.Channel)
+	case SlackAppChannel:
+		return typed.SlackChannel
+	default:
+		return channel
+	}
+}
+
+// sample event of the given kind, grouped by the first group of the rule when it groups alerts
+func previewEvent(kind string, alerts []Alert, rule Rule, alertaUrl string, language string) alertEvent {
+
+	group := GroupAlerts(alerts, rule.GroupBy)[0]
+
+	switch kind {
+	case "closed":
+		return ClosedAlertsEvent{Group: group.Name, GroupLabels: group.Labels, Alerts: group.Alerts, AlertaUrl: alertaUrl, Language: language}
+	case "flapping":
+		return FlappingAlertsEvent{Alerts: group.Alerts, Language: language}
+	case "severity":
+		// as if every alert was notified with the next less severe severity
+		names := severities.Names()
+		previous := make(map[string]string, len(group.Alerts))
+		for _, alert := range group.Alerts {
+			if rank := severities.Rank(alert.Severity); rank+1 < len(names) {
+				previous[alert.Id] = names[rank+1]
+			}
+		}
+		return SeverityChangedEvent{Group: group.Name, GroupLabels: group.Labels, Alerts: group.Alerts, Previous: previous, Increased: true, AlertaUrl: alertaUrl, Language: language}
+	case "storm":
+		return OpenAlertsEvent{Group: group.Name, GroupLabels: group.Labels, NewAlertCount: len(group.Alerts), NewAlerts: group.Alerts, Storm: true, AlertaUrl: alertaUrl, Language: language}
+	default:
+		inhibited := make([]Alert, 0)
+		if len(group.Alerts) > 1 {
+			inhibited = group.Alerts[len(group.Alerts)-1:]
+		}
+		return OpenAlertsEvent{Group: group.Name, GroupLabels: group.Labels, NewAlertCount: len(group.Alerts), NewAlerts: group.Alerts, AlreadyNotified: len(alerts) - len(group.Alerts), Inhibited: inhibited, AlertaUrl: alertaUrl, Language: language}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreviewServer(t *testing.T) {
+
+	config, err := Load("config/config.yml")
+	if err != nil {
+		t.Fatalf("cannot load config: %v", err)
+	}
+	channels, err := LoadChannels(config)
+	if err != nil {
+		t.Fatalf("cannot load channels: %v", err)
+	}
+	server := httptest.NewServer(PreviewServer{config: config, channels: channels, alertsFile: "test/alerts.json"}.Handler())
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := server.Client().Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("cannot get %v: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	tests := map[string]string{
+		"/": "/render?channel=slack_support&event=open&view=slack",
+		"/render?channel=mail_support&event=open&view=html":       "3 new alerts",
+		"/render?channel=mail_support&event=closed&view=text":     "3 alerts were closed",
+		"/render?channel=marketing&event=open&view=subject":       "[Webshop]",
+		"/render?channel=slack_support&event=flapping&view=slack": "&#34;blocks&#34;",
+		"/render?channel=mail_support&event=severity&view=text":   " -&gt; ",
+		"/render?channel=slack_support&event=severity&view=slack": "→",
+	}
+	for path, expected := range tests {
+		status, body := get(path)
+		if status != 200 || !strings.Contains(body, expected) {
+			t.Errorf("expected %v to contain '%v', got %v:\n%v", path, expected, status, body)
+		}
+	}
+
+	if status, _ := get("/render?channel=unknown"); status != 404 {
+		t.Errorf("expected 404 for unknown channel, got %v", status)
+	}
+	if _, fingerprint := get("/changes"); fingerprint == "" {
+		t.Errorf("expected fingerprint of the templates")
+	}
+}
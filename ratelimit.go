@@ -0,0 +1,405 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the number of messages per minute and per hour, a limit of 0 means unlimited
+type RateLimiter struct {
+	PerMinute int
+	PerHour   int
+
+	mutex sync.Mutex
+	sent  []time.Time
+}
+
+// Allow records a message sent at the given time, unless that would exceed one of the limits
+func (limiter *RateLimiter) Allow(now time.Time) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	recent := make([]time.Time, 0, len(limiter.sent)+1)
+	lastMinute := 0
+	for _, sent := range limiter.sent {
+		if now.Sub(sent) < time.Hour {
+			recent = append(recent, sent)
+			if now.Sub(sent) < time.Minute {
+				lastMinute++
+			}
+		}
+	}
+	limiter.sent = recent
+
+	if (limiter.PerMinute > 0 && lastMinute >= limiter.PerMinute) || (limiter.PerHour > 0 && len(recent) >= limiter.PerHour) {
+		return false
+	}
+	limiter.sent = append(limiter.sent, now)
+	return true
+}
+
+// LimitedChannel protects a channel against alert storms: open and closed alerts and severity changes above the rate
+// limits are queued per rule and group, and sent as soon as the limits allow it. Flapping alerts above the rate limits
+// are dropped.
+// Events with more alerts than the storm threshold are condensed into a summary with a link to Alerta.
+type LimitedChannel struct {
+	Name           string
+	Channel        Channel
+	Limiter        *RateLimiter
+	StormThreshold int
+
+	queue *alertQueue
+}
+
+// queuedChannel is implemented by channels that hold back alerts, they are sent at every evaluation of their rule
+type queuedChannel interface {
+	SendQueued(rule string, dryrun bool) error
+}
+
+// alerts held back by the rate limits of a channel, by rule and group
+type alertQueue struct {
+	mutex   sync.Mutex
+	entries map[queueKey]*queuedEvents
+}
+
+type queueKey struct {
+	rule  string
+	group string
+}
+
+// the events of a rule and group that are not sent yet, merged into one open, one closed, one increased and one
+// decreased severity event
+type queuedEvents struct {
+	open      *OpenAlertsEvent
+	closed    *ClosedAlertsEvent
+	increased *SeverityChangedEvent
+	decreased *SeverityChangedEvent
+}
+
+func (entry *queuedEvents) empty() bool {
+	return entry.open == nil && entry.closed == nil && entry.increased == nil && entry.decreased == nil
+}
+
+// queuedError tells that a message is held back by the rate limits of a channel, it is sent later
+type queuedError struct {
+	message string
+}
+
+func (err queuedError) Error() string {
+	return err.message
+}
+
+// isQueued tells whether a channel will still send the message it returned the error for
+func isQueued(err error) bool {
+	var queued queuedError
+	return errors.As(err, &queued)
+}
+
+func newAlertQueue() *alertQueue {
+	return &alertQueue{entries: make(map[queueKey]*queuedEvents)}
+}
+
+func (limited LimitedChannel) SendOpenAlerts(event OpenAlertsEvent, dryrun bool) error {
+	if !limited.Limiter.Allow(time.Now()) {
+		return limited.enqueueOpen(event)
+	}
+	event.Storm = limited.isStorm(event.NewAlertCount)
+	return limited.Channel.SendOpenAlerts(event, dryrun)
+}
+
+func (limited LimitedChannel) SendClosedAlerts(event ClosedAlertsEvent, dryrun bool) error {
+	if !limited.Limiter.Allow(time.Now()) {
+		return limited.enqueueClosed(event)
+	}
+	if limited.queue != nil {
+		// the severity changes of closed alerts are outdated
+		limited.queue.mutex.Lock()
+		limited.queue.removeSeverityChanges(event.Rule, event.Alerts)
+		limited.queue.mutex.Unlock()
+	}
+	event.Storm = limited.isStorm(len(event.Alerts))
+	return limited.Channel.SendClosedAlerts(event, dryrun)
+}
+
+func (limited LimitedChannel) SendFlappingAlerts(event FlappingAlertsEvent, dryrun bool) error {
+	if err := limited.allow(); err != nil {
+		return err
+	}
+	return limited.Channel.SendFlappingAlerts(event, dryrun)
+}
+
+func (limited LimitedChannel) SendSeverityChanged(event SeverityChangedEvent, dryrun bool) error {
+	if !limited.Limiter.Allow(time.Now()) {
+		return limited.enqueueSeverityChanged(event)
+	}
+	return limited.Channel.SendSeverityChanged(event, dryrun)
+}
+
+func (limited LimitedChannel) allow() error {
+	if !limited.Limiter.Allow(time.Now()) {
+		return fmt.Errorf("rate limit of channel '%v' exceeded, message dropped", limited.Name)
+	}
+	return nil
+}
+
+// SendQueued sends the open and the closed alerts and the severity changes of the rule held back by the rate limits,
+// as far as the limits allow
+func (limited LimitedChannel) SendQueued(rule string, dryrun bool) error {
+	if limited.queue == nil {
+		return nil
+	}
+	open, changed, closed := limited.queue.take(rule, func() bool { return limited.Limiter.Allow(time.Now()) })
+
+	for _, event := range open {
+		log.Printf("Sending %v open alerts of rule %v queued by the rate limit of channel '%v'", event.NewAlertCount, rule, limited.Name)
+		event.Storm = limited.isStorm(event.NewAlertCount)
+		if err := limited.Channel.SendOpenAlerts(event, dryrun); err != nil {
+			return err
+		}
+	}
+	for _, event := range changed {
+		log.Printf("Sending %v changed severities of rule %v queued by the rate limit of channel '%v'", len(event.Alerts), rule, limited.Name)
+		if err := limited.Channel.SendSeverityChanged(event, dryrun); err != nil {
+			return err
+		}
+	}
+	for _, event := range closed {
+		log.Printf("Sending %v closed alerts of rule %v queued by the rate limit of channel '%v'", len(event.Alerts), rule, limited.Name)
+		event.Storm = limited.isStorm(len(event.Alerts))
+		if err := limited.Channel.SendClosedAlerts(event, dryrun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removes the queued events of the rule from the queue, as long as allow permits another message.
+// The open events are taken before the severity changes and the closed events, the groups in order of their name.
+func (queue *alertQueue) take(rule string, allow func() bool) ([]OpenAlertsEvent, []SeverityChangedEvent, []ClosedAlertsEvent) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	keys := make([]queueKey, 0)
+	for key := range queue.entries {
+		if key.rule == rule {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].group < keys[j].group })
+
+	open := make([]OpenAlertsEvent, 0)
+	changed := make([]SeverityChangedEvent, 0)
+	closed := make([]ClosedAlertsEvent, 0)
+	for _, key := range keys {
+		if entry := queue.entries[key]; entry.open != nil && allow() {
+			open = append(open, *entry.open)
+			entry.open = nil
+		}
+	}
+	for _, key := range keys {
+		if entry := queue.entries[key]; entry.increased != nil && allow() {
+			changed = append(changed, *entry.increased)
+			entry.increased = nil
+		}
+		if entry := queue.entries[key]; entry.decreased != nil && allow() {
+			changed = append(changed, *entry.decreased)
+			entry.decreased = nil
+		}
+	}
+	for _, key := range keys {
+		if entry := queue.entries[key]; entry.closed != nil && allow() {
+			closed = append(closed, *entry.closed)
+			entry.closed = nil
+		}
+	}
+	for _, key := range keys {
+		if queue.entries[key].empty() {
+			delete(queue.entries, key)
+		}
+	}
+	return open, changed, closed
+}
+
+// holds back the open alerts of an event above the rate limits, merged with the queued open alerts of its rule and group
+func (limited LimitedChannel) enqueueOpen(event OpenAlertsEvent) error {
+	if limited.queue == nil {
+		return limited.allow()
+	}
+	queue := limited.queue
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	entry := queue.entry(event.Rule, event.Group)
+	if entry.open == nil {
+		event.NewAlerts = append([]Alert(nil), event.NewAlerts...)
+		event.Inhibited = append([]Alert(nil), event.Inhibited...)
+		entry.open = &event
+	} else {
+		entry.open.NewAlerts = append(entry.open.NewAlerts, event.NewAlerts...)
+		entry.open.NewAlertCount += event.NewAlertCount
+		entry.open.Inhibited = append(entry.open.Inhibited, event.Inhibited...)
+		entry.open.AlreadyNotified = event.AlreadyNotified
+		entry.open.GroupLabels = event.GroupLabels
+		entry.open.AlertaUrl = event.AlertaUrl
+	}
+	return queuedError{fmt.Sprintf("rate limit of channel '%v' exceeded, %v open alerts of rule %v are queued", limited.Name, entry.open.NewAlertCount, event.Rule)}
+}
+
+// holds back the closed alerts of an event above the rate limits. Alerts closed before their open alert was sent
+// are not sent at all.
+func (limited LimitedChannel) enqueueClosed(event ClosedAlertsEvent) error {
+	if limited.queue == nil {
+		return limited.allow()
+	}
+	queue := limited.queue
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.removeSeverityChanges(event.Rule, event.Alerts)
+	closed := make([]Alert, 0, len(event.Alerts))
+	for _, alert := range event.Alerts {
+		if !queue.removeOpen(event.Rule, alert.Id) {
+			closed = append(closed, alert)
+		}
+	}
+	if len(closed) == 0 {
+		return nil
+	}
+
+	entry := queue.entry(event.Rule, event.Group)
+	if entry.closed == nil {
+		event.Alerts = closed
+		entry.closed = &event
+	} else {
+		entry.closed.Alerts = append(entry.closed.Alerts, closed...)
+		entry.closed.GroupLabels = event.GroupLabels
+		entry.closed.AlertaUrl = event.AlertaUrl
+	}
+	return queuedError{fmt.Sprintf("rate limit of channel '%v' exceeded, %v closed alerts of rule %v are queued", limited.Name, len(entry.closed.Alerts), event.Rule)}
+}
+
+// holds back the severity changes of an event above the rate limits. An alert whose severity changes again before
+// the first change was sent is sent once, with the severity it was notified with before the first change.
+func (limited LimitedChannel) enqueueSeverityChanged(event SeverityChangedEvent) error {
+	if limited.queue == nil {
+		return limited.allow()
+	}
+	queue := limited.queue
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queuedPrevious := queue.removeSeverityChanges(event.Rule, event.Alerts)
+	alerts := make([]Alert, 0, len(event.Alerts))
+	previous := make(map[string]string, len(event.Alerts))
+	for _, alert := range event.Alerts {
+		notified, ok := queuedPrevious[alert.Id]
+		if !ok {
+			notified = event.Previous[alert.Id]
+		}
+		if notified == alert.Severity {
+			// changed back to the notified severity before the change was sent, there is nothing to send
+			continue
+		}
+		alerts = append(alerts, alert)
+		previous[alert.Id] = notified
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	entry := queue.entry(event.Rule, event.Group)
+	queued := &entry.decreased
+	if event.Increased {
+		queued = &entry.increased
+	}
+	if *queued == nil {
+		event.Alerts = alerts
+		event.Previous = previous
+		*queued = &event
+	} else {
+		(*queued).Alerts = append((*queued).Alerts, alerts...)
+		for id, severity := range previous {
+			(*queued).Previous[id] = severity
+		}
+		(*queued).GroupLabels = event.GroupLabels
+		(*queued).AlertaUrl = event.AlertaUrl
+	}
+	return queuedError{fmt.Sprintf("rate limit of channel '%v' exceeded, %v changed severities of rule %v are queued", limited.Name, len((*queued).Alerts), event.Rule)}
+}
+
+func (queue *alertQueue) entry(rule string, group string) *queuedEvents {
+	key := queueKey{rule, group}
+	entry, ok := queue.entries[key]
+	if !ok {
+		entry = &queuedEvents{}
+		queue.entries[key] = entry
+	}
+	return entry
+}
+
+// removes the alert from the queued open alerts of the rule, tells whether it was queued
+func (queue *alertQueue) removeOpen(rule string, alertId string) bool {
+	for key, entry := range queue.entries {
+		if key.rule != rule || entry.open == nil {
+			continue
+		}
+		for i, alert := range entry.open.NewAlerts {
+			if alert.Id == alertId {
+				entry.open.NewAlerts = append(entry.open.NewAlerts[:i:i], entry.open.NewAlerts[i+1:]...)
+				entry.open.NewAlertCount--
+				if len(entry.open.NewAlerts) == 0 {
+					entry.open = nil
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removes the alerts from the queued severity changes of the rule, returns the notified severity of the removed alerts
+func (queue *alertQueue) removeSeverityChanges(rule string, alerts []Alert) map[string]string {
+	ids := make(map[string]bool, len(alerts))
+	for _, alert := range alerts {
+		ids[alert.Id] = true
+	}
+	previous := make(map[string]string)
+	for key, entry := range queue.entries {
+		if key.rule != rule {
+			continue
+		}
+		for _, queued := range []**SeverityChangedEvent{&entry.increased, &entry.decreased} {
+			if *queued == nil {
+				continue
+			}
+			kept := make([]Alert, 0, len((*queued).Alerts))
+			for _, alert := range (*queued).Alerts {
+				if ids[alert.Id] {
+					previous[alert.Id] = (*queued).Previous[alert.Id]
+				} else {
+					kept = append(kept, alert)
+				}
+			}
+			(*queued).Alerts = kept
+			if len(kept) == 0 {
+				*queued = nil
+			}
+		}
+		if entry.empty() {
+			delete(queue.entries, key)
+		}
+	}
+	return previous
+}
+
+func (limited LimitedChannel) isStorm(alertCount int) bool {
+	if limited.StormThreshold > 0 && alertCount > limited.StormThreshold {
+		log.Printf("%v alerts exceed the storm threshold of channel '%v', sending a condensed message", alertCount, limited.Name)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	limiter := &RateLimiter{PerMinute: 2, PerHour: 3}
+	now := time.Now()
+
+	if !limiter.Allow(now) || !limiter.Allow(now.Add(time.Second)) {
+		t.Fatalf("expected first 2 messages to be allowed")
+	}
+	if limiter.Allow(now.Add(2 * time.Second)) {
+		t.Fatalf("expected third message within a minute to be dropped")
+	}
+	if !limiter.Allow(now.Add(2 * time.Minute)) {
+		t.Fatalf("expected message after a minute to be allowed")
+	}
+	if limiter.Allow(now.Add(5 * time.Minute)) {
+		t.Fatalf("expected fourth message within an hour to be dropped")
+	}
+	if !limiter.Allow(now.Add(61 * time.Minute)) {
+		t.Fatalf("expected message after an hour to be allowed")
+	}
+}
+
+func TestStormThreshold(t *testing.T) {
+
+	recording := &recordingChannel{}
+	channel := LimitedChannel{Name: "test", Channel: recording, Limiter: &RateLimiter{}, StormThreshold: 2}
+
+	alerts := readAlerts(t)
+	if err := channel.SendOpenAlerts(OpenAlertsEvent{NewAlertCount: len(alerts), NewAlerts: alerts}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := channel.SendOpenAlerts(OpenAlertsEvent{NewAlertCount: 1, NewAlerts: alerts[:1]}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !recording.open[0].Storm || recording.open[1].Storm {
+		t.Fatalf("expected only the event with %v alerts to be condensed", len(alerts))
+	}
+}
+
+func TestRateLimitedAlertsAreQueued(t *testing.T) {
+
+	recording := &recordingChannel{}
+	limiter := &RateLimiter{PerMinute: 1}
+	channel := LimitedChannel{Name: "test", Channel: recording, Limiter: limiter, queue: newAlertQueue()}
+
+	alerts := readAlerts(t)
+	if err := channel.SendOpenAlerts(OpenAlertsEvent{NewAlertCount: 1, NewAlerts: alerts[:1], Rule: "a"}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	open := OpenAlertsEvent{Group: "web", GroupLabels: map[string]string{"service": "web"}, NewAlertCount: 2, NewAlerts: alerts[1:3], Rule: "a", AlertaUrl: "http://alerta/#/alerts?a"}
+	if err := channel.SendOpenAlerts(open, true); err == nil {
+		t.Fatalf("expected the rate limit to be exceeded")
+	}
+	if err := channel.SendOpenAlerts(OpenAlertsEvent{NewAlertCount: 1, NewAlerts: alerts[3:4], Rule: "b", AlertaUrl: "http://alerta/#/alerts?b"}, true); err == nil {
+		t.Fatalf("expected the rate limit to be exceeded")
+	}
+	if err := channel.SendClosedAlerts(ClosedAlertsEvent{Alerts: alerts[2:3], Rule: "a"}, true); err != nil {
+		t.Fatalf("expected no closed alerts to be queued for an alert that was never sent, got %v", err)
+	}
+	if err := channel.SendQueued("a", true); err != nil || len(recording.open) != 1 {
+		t.Fatalf("expected queued alerts to be held back while the rate limit is exceeded, got %v messages: %v", len(recording.open), err)
+	}
+
+	limiter.sent = nil
+	if err := channel.SendQueued("a", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recording.open) != 2 || len(recording.open[1].NewAlerts) != 1 || recording.open[1].NewAlerts[0].Id != alerts[1].Id {
+		t.Fatalf("expected the queued alert of rule a that is still open to be sent, got %v", recording.open)
+	}
+	if sent := recording.open[1]; sent.Group != "web" || sent.GroupLabels["service"] != "web" || sent.AlertaUrl != open.AlertaUrl {
+		t.Fatalf("expected the group and link of rule a, got %v", sent)
+	}
+	if len(recording.closed) != 0 {
+		t.Fatalf("expected no closed message for an alert that was never sent, got %v", recording.closed)
+	}
+
+	limiter.sent = nil
+	if err := channel.SendQueued("b", true); err != nil || len(recording.open) != 3 || recording.open[2].AlertaUrl != "http://alerta/#/alerts?b" {
+		t.Fatalf("expected the queued alert of rule b to be sent with its own link, got %v: %v", recording.open, err)
+	}
+}
+
+func TestRateLimitedSeverityChangesAreQueued(t *testing.T) {
+
+	recording := &recordingChannel{}
+	limiter := &RateLimiter{PerMinute: 1}
+	channel := LimitedChannel{Name: "test", Channel: recording, Limiter: limiter, queue: newAlertQueue()}
+	limiter.Allow(time.Now())
+
+	db := Alert{Id: "1", Severity: "major"}
+	web := Alert{Id: "2", Severity: "critical"}
+	increased := SeverityChangedEvent{Alerts: []Alert{db, web}, Previous: map[string]string{"1": "minor", "2": "minor"}, Increased: true, Rule: "a"}
+	if err := channel.SendSeverityChanged(increased, true); !isQueued(err) {
+		t.Fatalf("expected the severity changes to be queued, got %v", err)
+	}
+
+	// the severity of db increases again and web is back at the severity it was notified with
+	db.Severity = "critical"
+	web.Severity = "minor"
+	if err := channel.SendSeverityChanged(SeverityChangedEvent{Alerts: []Alert{db}, Previous: map[string]string{"1": "major"}, Increased: true, Rule: "a"}, true); !isQueued(err) {
+		t.Fatalf("expected the severity change to be queued, got %v", err)
+	}
+	if err := channel.SendSeverityChanged(SeverityChangedEvent{Alerts: []Alert{web}, Previous: map[string]string{"2": "critical"}, Increased: false, Rule: "a"}, true); err != nil {
+		t.Fatalf("expected nothing to be queued for an alert back at its notified severity, got %v", err)
+	}
+
+	limiter.sent = nil
+	if err := channel.SendQueued("a", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recording.severity) != 1 || len(recording.severity[0].Alerts) != 1 || recording.severity[0].Alerts[0].Severity != "critical" || recording.severity[0].PreviousSeverity("1") != "minor" {
+		t.Fatalf("expected one change of db from minor to critical, got %v", recording.severity)
+	}
+}
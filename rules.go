@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"sync"
 	"time"
 )
 
@@ -14,62 +15,83 @@ type RuleHandler struct {
 	channels map[string]Channel
 
 	openAlerts []Alert
+	flaps      *FlapDetector
 
 	dryRun bool
 }
 
-func (handler *RuleHandler) handle(time time.Time) {
-	log.Printf("Evaluating rule %v (%v)", handler.ruleName, time)
-	openAlerts := handler.alerta.searchAlerts(handler.rule)
+func (handler *RuleHandler) fetch() []Alert {
+	return handler.alerta.searchAlerts(handler.rule)
+}
 
-	if openAlerts != nil && len(openAlerts) > 0 {
+func (handler *RuleHandler) handle(now time.Time, openAlerts []Alert, inhibitor Inhibitor) {
+	log.Printf("Evaluating rule %v (%v)", handler.ruleName, now)
 
-		alreadyNotified, notNotified := Partition(openAlerts, handler.ruleName, IsNotified)
+	handler.sendQueued()
+
+	if handler.flaps == nil {
+		handler.flaps = NewFlapDetector(handler.rule.Flapping)
+	}
+	startedFlapping, stabilized := handler.flaps.Update(now, handler.openAlerts, openAlerts)
+	if len(startedFlapping) > 0 {
+		log.Printf("%v alerts started flapping for rule %v", len(startedFlapping), handler.ruleName)
+		handler.sendFlappingAlerts(FlappingAlertsEvent{Alerts: startedFlapping})
+	}
 
-		if nrOfAlerts := len(notNotified); nrOfAlerts > 0 {
+	if openAlerts != nil && len(openAlerts) > 0 {
 
-			for _, ruleChannel := range handler.rule.Channels {
-				log.Printf("Sending %v alert(s) to channel %v of rule %v", nrOfAlerts, ruleChannel, handler.ruleName)
+		alreadyNotified, notNotified := Partition(openAlerts, handler.ruleName, IsNotified)
+		notNotified, belowMinimum := handler.partitionSeverity(notNotified)
+		if len(belowMinimum) > 0 {
+			log.Printf("%v alerts are below the minimum severity of rule %v", len(belowMinimum), handler.ruleName)
+		}
+		notNotified, inhibited := inhibitor.Partition(notNotified)
+		if len(inhibited) > 0 {
+			log.Printf("%v alerts are inhibited for rule %v", len(inhibited), handler.ruleName)
+		}
+		notNotified, flapping := handler.flaps.Partition(notNotified)
+		if len(flapping) > 0 {
+			log.Printf("%v alerts are flapping for rule %v", len(flapping), handler.ruleName)
+		}
+		notNotified, pending := handler.partitionPending(notNotified, now)
+		if len(pending) > 0 {
+			log.Printf("%v alerts are pending for rule %v", len(pending), handler.ruleName)
+		}
 
-				channel, ok := handler.channels[ruleChannel]
-				if !ok {
-					log.Fatalf("Unable to find channel '%v' of rule '%v' in channel config", ruleChannel, handler.ruleName)
-				}
+		for _, group := range GroupAlerts(notNotified, handler.rule.GroupBy) {
 
-				sendError := channel.SendOpenAlerts(OpenAlertsEvent{NewAlertCount: nrOfAlerts, NewAlerts: notNotified, AlreadyNotified: len(alreadyNotified)}, handler.dryRun)
-				if sendError != nil {
-					log.Printf("Error sending alert event to channel '%v' of rule '%v': %v", ruleChannel, handler.ruleName, sendError)
-				}
+			event := OpenAlertsEvent{
+				Group:           group.Name,
+				GroupLabels:     group.Labels,
+				NewAlertCount:   len(group.Alerts),
+				NewAlerts:       group.Alerts,
+				AlreadyNotified: len(group.Filter(alreadyNotified)),
+				Inhibited:       group.Filter(inhibited),
+				Rule:            handler.ruleName,
+				AlertaUrl:       handler.alerta.alertsUrl(handler.rule),
 			}
+			handler.sendOpenAlerts(event)
+		}
 
-			for _, alert := range notNotified {
-				alert.Notified(handler.ruleName)
-				updateError := handler.alerta.updateAttributes(alert, handler.dryRun)
-				if updateError != nil {
-					log.Printf("Error updating alert attributes for alert '%v' and rule '%v': %v", alert, handler.ruleName, updateError)
-				}
+		for _, alert := range notNotified {
+			alert.Notified(handler.ruleName)
+			updateError := handler.alerta.updateAttributes(alert, handler.dryRun)
+			if updateError != nil {
+				log.Printf("Error updating alert attributes for alert '%v' and rule '%v': %v", alert, handler.ruleName, updateError)
 			}
 		}
 		log.Printf("%v alerts were already notified for rule %v", len(alreadyNotified), handler.ruleName)
+
+		handler.handleSeverityChanges(alreadyNotified)
 	} else {
 		log.Printf("No Alerts found for rule %v", handler.ruleName)
 	}
 
-	if closedAlerts := handler.getClosedAlerts(openAlerts); closedAlerts != nil && len(closedAlerts) > 0 {
+	if closedAlerts := handler.getClosedAlerts(openAlerts, stabilized); closedAlerts != nil && len(closedAlerts) > 0 {
 		log.Printf("%v alerts were closed for rule %v", len(closedAlerts), handler.ruleName)
 
-		for _, ruleChannel := range handler.rule.Channels {
-			log.Printf("Sending %v closed alert(s) to channel %v of rule %v", len(closedAlerts), ruleChannel, handler.ruleName)
-
-			channel, ok := handler.channels[ruleChannel]
-			if !ok {
-				log.Fatalf("Unable to find channel '%v' of rule '%v' in channel config", ruleChannel, handler.ruleName)
-			}
-
-			sendError := channel.SendClosedAlerts(ClosedAlertsEvent{Alerts: closedAlerts}, handler.dryRun)
-			if sendError != nil {
-				log.Printf("Error sending closed alerts event to channel '%v' of rule '%v': %v", ruleChannel, handler.ruleName, sendError)
-			}
+		for _, group := range GroupAlerts(closedAlerts, handler.rule.GroupBy) {
+			handler.sendClosedAlerts(ClosedAlertsEvent{Group: group.Name, GroupLabels: group.Labels, Alerts: group.Alerts, Rule: handler.ruleName, AlertaUrl: handler.alerta.alertsUrl(handler.rule)})
 		}
 	} else {
 		log.Printf("0 alerts were closed for rule %v", handler.ruleName)
@@ -79,14 +101,201 @@ func (handler *RuleHandler) handle(time time.Time) {
 	log.Printf("tracking %v open alerts for rule %v", len(handler.openAlerts), handler.ruleName)
 }
 
-func (handler *RuleHandler) getClosedAlerts(currentOpenAlerts []Alert) []Alert {
-	if currentOpenAlerts == nil || len(currentOpenAlerts) == 0 {
-		return handler.openAlerts
+// Alerts must be open for at least the 'for' duration of the rule before they are notified,
+// so alerts that are closed again within that period don't generate any notification.
+func (handler *RuleHandler) partitionPending(alerts []Alert, now time.Time) ([]Alert, []Alert) {
+	ready := make([]Alert, 0)
+	pending := make([]Alert, 0)
+	for _, alert := range alerts {
+		if now.Sub(alert.CreateTime) < time.Duration(handler.rule.For) {
+			pending = append(pending, alert)
+		} else {
+			ready = append(ready, alert)
+		}
+	}
+	return ready, pending
+}
+
+func (handler *RuleHandler) sendOpenAlerts(event OpenAlertsEvent) {
+	handler.sendToChannels(func(ruleChannel string, channel Channel) {
+		log.Printf("Sending %v alert(s) to channel %v of rule %v", event.NewAlertCount, ruleChannel, handler.ruleName)
+
+		sendError := channel.SendOpenAlerts(event, handler.dryRun)
+		if sendError != nil {
+			log.Printf("Error sending alert event to channel '%v' of rule '%v': %v", ruleChannel, handler.ruleName, sendError)
+		}
+	})
+}
+
+// sends the alerts of the rule that channels held back, e.g. because of their rate limits
+func (handler *RuleHandler) sendQueued() {
+	handler.sendToChannels(func(ruleChannel string, channel Channel) {
+		if queued, ok := channel.(queuedChannel); ok {
+			sendError := queued.SendQueued(handler.ruleName, handler.dryRun)
+			if sendError != nil {
+				log.Printf("Error sending queued alerts to channel '%v' of rule '%v': %v", ruleChannel, handler.ruleName, sendError)
+			}
+		}
+	})
+}
+
+func (handler *RuleHandler) sendFlappingAlerts(event FlappingAlertsEvent) {
+	handler.sendToChannels(func(ruleChannel string, channel Channel) {
+		log.Printf("Sending %v flapping alert(s) to channel %v of rule %v", len(event.Alerts), ruleChannel, handler.ruleName)
+
+		sendError := channel.SendFlappingAlerts(event, handler.dryRun)
+		if sendError != nil {
+			log.Printf("Error sending flapping alerts event to channel '%v' of rule '%v': %v", ruleChannel, handler.ruleName, sendError)
+		}
+	})
+}
+
+// sends the severity changes to the channels of the rule, tells whether at least one channel sent or queued them
+func (handler *RuleHandler) sendSeverityChanged(event SeverityChangedEvent) bool {
+	var mutex sync.Mutex
+	delivered := false
+	handler.sendToChannels(func(ruleChannel string, channel Channel) {
+		log.Printf("Sending %v changed severities to channel %v of rule %v", len(event.Alerts), ruleChannel, handler.ruleName)
+
+		sendError := channel.SendSeverityChanged(event, handler.dryRun)
+		if sendError != nil {
+			log.Printf("Error sending severity changed event to channel '%v' of rule '%v': %v", ruleChannel, handler.ruleName, sendError)
+		}
+		if sendError == nil || isQueued(sendError) {
+			mutex.Lock()
+			delivered = true
+			mutex.Unlock()
+		}
+	})
+	return delivered
+}
+
+func (handler *RuleHandler) sendClosedAlerts(event ClosedAlertsEvent) {
+	handler.sendToChannels(func(ruleChannel string, channel Channel) {
+		log.Printf("Sending %v closed alert(s) to channel %v of rule %v", len(event.Alerts), ruleChannel, handler.ruleName)
+
+		sendError := channel.SendClosedAlerts(event, handler.dryRun)
+		if sendError != nil {
+			log.Printf("Error sending closed alerts event to channel '%v' of rule '%v': %v", ruleChannel, handler.ruleName, sendError)
+		}
+	})
+}
+
+// sends an event to all channels of the rule at the same time, so a slow channel doesn't delay the others.
+// Returns when the event is sent to all channels, so every channel gets the events of the rule in order.
+func (handler *RuleHandler) sendToChannels(send func(ruleChannel string, channel Channel)) {
+	var sent sync.WaitGroup
+	for _, ruleChannel := range handler.rule.Channels {
+		channel := handler.channel(ruleChannel)
+		sent.Add(1)
+		go func(ruleChannel string) {
+			defer sent.Done()
+			send(ruleChannel, channel)
+		}(ruleChannel)
+	}
+	sent.Wait()
+}
+
+// Already notified alerts that became more severe are notified again, alerts that became less severe only when the rule
+// asks for it. The notified severity is recorded once a channel sent or queued the change, alerts notified before
+// severities were tracked only get it recorded.
+func (handler *RuleHandler) handleSeverityChanges(alreadyNotified []Alert) {
+
+	increased := make([]Alert, 0)
+	decreased := make([]Alert, 0)
+	previous := make(map[string]string)
+	untracked := make([]Alert, 0)
+
+	for _, alert := range alreadyNotified {
+		notifiedSeverity := alert.NotifiedSeverity(handler.ruleName)
+		if notifiedSeverity == alert.Severity || handler.flaps.IsFlapping(alert) {
+			continue
+		}
+		if notifiedSeverity != "" {
+			switch {
+			case severities.Rank(alert.Severity) < severities.Rank(notifiedSeverity) && handler.meetsMinSeverity(alert):
+				increased = append(increased, alert)
+			case severities.Rank(alert.Severity) < severities.Rank(notifiedSeverity):
+				// still below the minimum severity, it is notified when it becomes severe enough
+				continue
+			case handler.rule.NotifySeverityDecrease:
+				decreased = append(decreased, alert)
+			default:
+				// the notified severity is kept, so the alert is notified again when it becomes more severe than that
+				continue
+			}
+			previous[alert.Id] = notifiedSeverity
+		} else {
+			untracked = append(untracked, alert)
+		}
 	}
 
+	notified := untracked
+
+	if len(increased) > 0 {
+		log.Printf("Severity of %v alerts increased for rule %v", len(increased), handler.ruleName)
+	}
+	for _, group := range GroupAlerts(increased, handler.rule.GroupBy) {
+		if handler.sendSeverityChanged(SeverityChangedEvent{Group: group.Name, GroupLabels: group.Labels, Alerts: group.Alerts, Previous: previous, Increased: true, Rule: handler.ruleName, AlertaUrl: handler.alerta.alertsUrl(handler.rule)}) {
+			notified = append(notified, group.Alerts...)
+		}
+	}
+	if len(decreased) > 0 {
+		log.Printf("Severity of %v alerts decreased for rule %v", len(decreased), handler.ruleName)
+	}
+	for _, group := range GroupAlerts(decreased, handler.rule.GroupBy) {
+		if handler.sendSeverityChanged(SeverityChangedEvent{Group: group.Name, GroupLabels: group.Labels, Alerts: group.Alerts, Previous: previous, Increased: false, Rule: handler.ruleName, AlertaUrl: handler.alerta.alertsUrl(handler.rule)}) {
+			notified = append(notified, group.Alerts...)
+		}
+	}
+
+	// alerts whose change was not delivered keep their notified severity, so the change is sent at the next evaluation
+	for _, alert := range notified {
+		alert.RecordSeverity(handler.ruleName, alert.Severity)
+		updateError := handler.alerta.updateAttributes(alert, handler.dryRun)
+		if updateError != nil {
+			log.Printf("Error updating alert attributes for alert '%v' and rule '%v': %v", alert, handler.ruleName, updateError)
+		}
+	}
+}
+
+// Only alerts that are at least as severe as the minimum severity of the rule are notified. Less severe alerts are
+// still tracked as open, so they are not reported as closed and are notified when they become severe enough.
+func (handler *RuleHandler) partitionSeverity(alerts []Alert) ([]Alert, []Alert) {
+	severe := make([]Alert, 0, len(alerts))
+	below := make([]Alert, 0)
+	for _, alert := range alerts {
+		if handler.meetsMinSeverity(alert) {
+			severe = append(severe, alert)
+		} else {
+			below = append(below, alert)
+		}
+	}
+	return severe, below
+}
+
+func (handler *RuleHandler) meetsMinSeverity(alert Alert) bool {
+	return handler.rule.MinSeverity == "" || severities.AtLeast(alert.Severity, handler.rule.MinSeverity)
+}
+
+func (handler *RuleHandler) channel(ruleChannel string) Channel {
+	channel, ok := handler.channels[ruleChannel]
+	if !ok {
+		log.Fatalf("Unable to find channel '%v' of rule '%v' in channel config", ruleChannel, handler.ruleName)
+	}
+	return channel
+}
+
+// Alerts that were open and notified during the previous evaluation, but are no longer open.
+// Alerts that were never notified (e.g. because they were inhibited) are not reported as closed,
+// flapping alerts are only reported once they are stable and closed.
+func (handler *RuleHandler) getClosedAlerts(currentOpenAlerts []Alert, stabilized []Alert) []Alert {
+	candidates := append(append(make([]Alert, 0), handler.openAlerts...), stabilized...)
+
 	closedAlerts := make([]Alert, 0)
-	for _, previouslyOpenAlert := range handler.openAlerts {
-		if !Contains(previouslyOpenAlert, currentOpenAlerts) {
+	for _, previouslyOpenAlert := range candidates {
+		if !Contains(previouslyOpenAlert, currentOpenAlerts) && !Contains(previouslyOpenAlert, closedAlerts) &&
+			IsNotified(previouslyOpenAlert, handler.ruleName) && !handler.flaps.IsFlapping(previouslyOpenAlert) {
 			closedAlerts = append(closedAlerts, previouslyOpenAlert)
 		}
 	}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+type recordingChannel struct {
+	open     []OpenAlertsEvent
+	closed   []ClosedAlertsEvent
+	flapping []FlappingAlertsEvent
+	severity []SeverityChangedEvent
+}
+
+func (channel *recordingChannel) SendOpenAlerts(event OpenAlertsEvent, dryrun bool) error {
+	channel.open = append(channel.open, event)
+	return nil
+}
+
+func (channel *recordingChannel) SendClosedAlerts(event ClosedAlertsEvent, dryrun bool) error {
+	channel.closed = append(channel.closed, event)
+	return nil
+}
+
+func (channel *recordingChannel) SendFlappingAlerts(event FlappingAlertsEvent, dryrun bool) error {
+	channel.flapping = append(channel.flapping, event)
+	return nil
+}
+
+func (channel *recordingChannel) SendSeverityChanged(event SeverityChangedEvent, dryrun bool) error {
+	channel.severity = append(channel.severity, event)
+	return nil
+}
+
+func newTestRuleHandler(rule Rule) (RuleHandler, *recordingChannel) {
+	channel := &recordingChannel{}
+	rule.Channels = []string{"test"}
+	handler := RuleHandler{ruleName: "test", rule: rule, channels: map[string]Channel{"test": channel}, dryRun: true}
+	return handler, channel
+}
+
+func TestPendingAlertsAreNotNotified(t *testing.T) {
+
+	handler, channel := newTestRuleHandler(Rule{For: Duration(time.Minute)})
+	now := time.Now()
+
+	flapping := Alert{Id: "1", CreateTime: now.Add(-10 * time.Second), Attributes: map[string]string{}}
+	stable := Alert{Id: "2", CreateTime: now.Add(-5 * time.Minute), Attributes: map[string]string{}}
+
+	handler.handle(now, []Alert{flapping, stable}, Inhibitor{})
+
+	if len(channel.open) != 1 || channel.open[0].NewAlertCount != 1 || channel.open[0].NewAlerts[0].Id != stable.Id {
+		t.Fatalf("expected only alert %v to be notified, got %v", stable.Id, channel.open)
+	}
+
+	handler.handle(now.Add(time.Minute), []Alert{}, Inhibitor{})
+
+	if len(channel.closed) != 1 || len(channel.closed[0].Alerts) != 1 || channel.closed[0].Alerts[0].Id != stable.Id {
+		t.Fatalf("expected only a closed message for alert %v, got %v", stable.Id, channel.closed)
+	}
+}
+
+func TestFlappingAlertsAreSuppressed(t *testing.T) {
+
+	handler, channel := newTestRuleHandler(Rule{Flapping: Flapping{Threshold: 3, Window: Duration(10 * time.Minute), StablePeriod: Duration(5 * time.Minute)}})
+	now := time.Now()
+	alert := Alert{Id: "1", CreateTime: now, Attributes: map[string]string{}}
+
+	// open, close, open, close: the alert starts flapping at the third transition
+	for i, open := range []bool{true, false, true, false, true, false} {
+		alerts := []Alert{}
+		if open {
+			alerts = append(alerts, alert)
+		}
+		handler.handle(now.Add(time.Duration(i)*time.Minute), alerts, Inhibitor{})
+	}
+
+	if len(channel.flapping) != 1 {
+		t.Fatalf("expected one flapping notification, got %v", channel.flapping)
+	}
+	if len(channel.open) != 1 || len(channel.closed) != 1 {
+		t.Fatalf("expected transitions to be suppressed while flapping, got %v open and %v closed", channel.open, channel.closed)
+	}
+
+	handler.handle(now.Add(15*time.Minute), []Alert{}, Inhibitor{})
+	if handler.flaps.IsFlapping(alert) {
+		t.Fatalf("expected alert to be stable after the stable period")
+	}
+}
+
+func TestMinimumSeverity(t *testing.T) {
+
+	handler, channel := newTestRuleHandler(Rule{MinSeverity: "major"})
+
+	critical := Alert{Id: "1", Severity: "critical", Attributes: map[string]string{}}
+	major := Alert{Id: "2", Severity: "major", Attributes: map[string]string{}}
+	warning := Alert{Id: "3", Severity: "warning", Attributes: map[string]string{}}
+
+	handler.handle(time.Now(), []Alert{critical, major, warning}, Inhibitor{})
+
+	if len(channel.open) != 1 || channel.open[0].NewAlertCount != 2 || Contains(warning, channel.open[0].NewAlerts) {
+		t.Fatalf("expected only the critical and major alert to be notified, got %v", channel.open)
+	}
+}
+
+func TestAlertsBelowMinimumSeverityStayOpen(t *testing.T) {
+
+	handler, channel := newTestRuleHandler(Rule{MinSeverity: "major"})
+	now := time.Now()
+
+	alert := Alert{Id: "1", Severity: "major", Attributes: map[string]string{}}
+	handler.handle(now, []Alert{alert}, Inhibitor{})
+
+	alert.Severity = "warning"
+	handler.handle(now.Add(time.Minute), []Alert{alert}, Inhibitor{})
+
+	if len(channel.open) != 1 || len(channel.closed) != 0 || len(channel.severity) != 0 {
+		t.Fatalf("expected the downgraded alert to stay open without notifications, got %v, %v and %v", channel.open, channel.closed, channel.severity)
+	}
+
+	alert.Severity = "critical"
+	handler.handle(now.Add(2*time.Minute), []Alert{alert}, Inhibitor{})
+
+	if len(channel.severity) != 1 || !channel.severity[0].Increased || channel.severity[0].PreviousSeverity(alert.Id) != "major" {
+		t.Fatalf("expected the escalated alert to be notified, got %v", channel.severity)
+	}
+
+	handler.handle(now.Add(3*time.Minute), []Alert{}, Inhibitor{})
+
+	if len(channel.closed) != 1 {
+		t.Fatalf("expected the alert to be closed once, got %v", channel.closed)
+	}
+}
+
+func TestSeverityChanges(t *testing.T) {
+
+	handler, channel := newTestRuleHandler(Rule{})
+	now := time.Now()
+
+	alert := Alert{Id: "1", Severity: "minor", Attributes: map[string]string{}}
+	handler.handle(now, []Alert{alert}, Inhibitor{})
+
+	alert.Severity = "critical"
+	handler.handle(now.Add(time.Minute), []Alert{alert}, Inhibitor{})
+
+	if len(channel.open) != 1 || len(channel.severity) != 1 || !channel.severity[0].Increased || channel.severity[0].PreviousSeverity(alert.Id) != "minor" {
+		t.Fatalf("expected one open and one increased severity event from minor, got %v and %v", channel.open, channel.severity)
+	}
+
+	alert.Severity = "major"
+	handler.handle(now.Add(2*time.Minute), []Alert{alert}, Inhibitor{})
+
+	if len(channel.severity) != 1 || alert.NotifiedSeverity("test") != "critical" {
+		t.Fatalf("expected no event for a decreased severity, got %v", channel.severity)
+	}
+
+	handler.rule.NotifySeverityDecrease = true
+	handler.handle(now.Add(3*time.Minute), []Alert{alert}, Inhibitor{})
+
+	if len(channel.severity) != 2 || channel.severity[1].Increased || alert.NotifiedSeverity("test") != "major" {
+		t.Fatalf("expected a decreased severity event, got %v", channel.severity)
+	}
+}
+
+func TestSeverityIsRecordedOnlyWhenDelivered(t *testing.T) {
+
+	handler, recording := newTestRuleHandler(Rule{})
+	limiter := &RateLimiter{PerMinute: 1}
+	handler.channels["test"] = LimitedChannel{Name: "test", Channel: recording, Limiter: limiter}
+	now := time.Now()
+
+	alert := Alert{Id: "1", Severity: "minor", Attributes: map[string]string{}}
+	handler.handle(now, []Alert{alert}, Inhibitor{})
+
+	alert.Severity = "critical"
+	handler.handle(now.Add(time.Second), []Alert{alert}, Inhibitor{})
+
+	if len(recording.severity) != 0 || alert.NotifiedSeverity("test") != "minor" {
+		t.Fatalf("expected the notified severity to be kept when the change is dropped, got %v", alert.NotifiedSeverity("test"))
+	}
+
+	limiter.sent = nil
+	handler.handle(now.Add(time.Minute), []Alert{alert}, Inhibitor{})
+
+	if len(recording.severity) != 1 || recording.severity[0].PreviousSeverity(alert.Id) != "minor" || alert.NotifiedSeverity("test") != "critical" {
+		t.Fatalf("expected the change to be sent at the next evaluation, got %v", recording.severity)
+	}
+}
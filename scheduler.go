@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// number of rules evaluated at the same time when no workers are configured
+const defaultWorkers = 4
+
+// Scheduler evaluates every rule at its own interval, so a slow rule or channel doesn't delay the other rules.
+// At most workers rules are evaluated at the same time, and a rule is never evaluated while its previous
+// evaluation is still running.
+type Scheduler struct {
+	rules        []*scheduledRule
+	inhibitRules []InhibitRule
+	workers      chan struct{}
+	done         chan struct{}
+
+	mutex     sync.Mutex
+	snapshots map[string][]Alert // the latest alerts of every rule, the inhibit rules are evaluated against them
+}
+
+type scheduledRule struct {
+	handler  *RuleHandler
+	interval time.Duration
+	mutex    sync.Mutex // held while the rule is evaluated
+}
+
+func NewScheduler(config Config, client AlertaClient, channels map[string]Channel) *Scheduler {
+
+	workers := config.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	scheduler := &Scheduler{
+		inhibitRules: config.InhibitRules,
+		workers:      make(chan struct{}, workers),
+		done:         make(chan struct{}),
+		snapshots:    make(map[string][]Alert),
+	}
+
+	for ruleName, rule := range config.Rules {
+		if strings.Trim(ruleName, " ") == "" {
+			continue
+		}
+		interval := time.Duration(rule.Interval)
+		if interval <= 0 {
+			interval = time.Duration(config.Alerta.ReloadInterval)
+		}
+		handler := &RuleHandler{alerta: client, ruleName: ruleName, rule: rule, channels: channels, dryRun: config.DryRun}
+		scheduler.rules = append(scheduler.rules, &scheduledRule{handler: handler, interval: interval})
+	}
+	return scheduler
+}
+
+// Start evaluates every rule after its first interval and then at every interval, until the scheduler is stopped.
+// The alerts of all rules are fetched first, so the first evaluation of a rule knows the alerts of the other rules
+// for the inhibit rules.
+func (scheduler *Scheduler) Start() {
+
+	var fetched sync.WaitGroup
+	for _, rule := range scheduler.rules {
+		fetched.Add(1)
+		go func(rule *scheduledRule) {
+			defer fetched.Done()
+			scheduler.workers <- struct{}{}
+			defer func() { <-scheduler.workers }()
+			scheduler.updateSnapshot(rule.handler.ruleName, rule.handler.fetch())
+		}(rule)
+	}
+	fetched.Wait()
+
+	for _, rule := range scheduler.rules {
+		log.Printf("Waiting for %v before fetching the alerts of rule %v", rule.interval, rule.handler.ruleName)
+
+		go func(rule *scheduledRule) {
+			ticker := time.NewTicker(rule.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case t := <-ticker.C:
+					scheduler.evaluate(rule, t)
+				case <-scheduler.done:
+					return
+				}
+			}
+		}(rule)
+	}
+}
+
+func (scheduler *Scheduler) Stop() {
+	close(scheduler.done)
+}
+
+// evaluate fetches the alerts of the rule and notifies its channels, as soon as a worker is available
+func (scheduler *Scheduler) evaluate(rule *scheduledRule, now time.Time) {
+
+	rule.mutex.Lock()
+	defer rule.mutex.Unlock()
+
+	scheduler.workers <- struct{}{}
+	defer func() { <-scheduler.workers }()
+
+	alerts := rule.handler.fetch()
+	rule.handler.handle(now, alerts, scheduler.updateSnapshot(rule.handler.ruleName, alerts))
+}
+
+// records the latest alerts of the rule and returns the inhibitor of the latest alerts of all rules.
+// The snapshot is a copy, the evaluation of the rule changes the attributes of its alerts while other rules read them.
+func (scheduler *Scheduler) updateSnapshot(ruleName string, alerts []Alert) Inhibitor {
+
+	snapshot := make([]Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		snapshot = append(snapshot, alert.copy())
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	scheduler.snapshots[ruleName] = snapshot
+	fetched := make([][]Alert, 0, len(scheduler.snapshots))
+	for _, snapshot := range scheduler.snapshots {
+		fetched = append(fetched, snapshot)
+	}
+	return NewInhibitor(scheduler.inhibitRules, fetched...)
+}
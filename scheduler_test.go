@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingChannel signals when it receives an event and returns when it is released
+type blockingChannel struct {
+	recordingChannel
+	received chan string
+	release  chan struct{}
+}
+
+func newBlockingChannel() *blockingChannel {
+	return &blockingChannel{received: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (channel *blockingChannel) SendOpenAlerts(event OpenAlertsEvent, dryrun bool) error {
+	channel.received <- event.NewAlerts[0].Id
+	<-channel.release
+	return nil
+}
+
+// scheduler with a rule per channel, every rule gets one alert with the name of the rule as id
+func newTestScheduler(t *testing.T, workers int, channels map[string]Channel, rules map[string]Rule) *Scheduler {
+	alerta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"alerts": [{"id": "%v", "severity": "major"}]}`, r.URL.RawQuery)
+	}))
+	t.Cleanup(alerta.Close)
+
+	for name, rule := range rules {
+		rule.Filter = name
+		rules[name] = rule
+	}
+	config := Config{DryRun: true, Workers: workers, Rules: rules, Alerta: Alerta{Endpoint: alerta.URL, ReloadInterval: Duration(time.Minute)}}
+	return NewScheduler(config, AlertaClient{config: config.Alerta}, channels)
+}
+
+func (scheduler *Scheduler) rule(name string) *scheduledRule {
+	for _, rule := range scheduler.rules {
+		if rule.handler.ruleName == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+func TestSlowRuleDoesNotDelayOtherRules(t *testing.T) {
+
+	slow, fast := newBlockingChannel(), &recordingChannel{}
+	scheduler := newTestScheduler(t, 2, map[string]Channel{"slow": slow, "fast": fast}, map[string]Rule{
+		"slow": {Channels: []string{"slow"}},
+		"fast": {Channels: []string{"fast"}, Interval: Duration(10 * time.Second)},
+	})
+	if scheduler.rule("fast").interval != 10*time.Second || scheduler.rule("slow").interval != time.Minute {
+		t.Errorf("expected the interval of the rule or else the reload interval, got %v and %v", scheduler.rule("fast").interval, scheduler.rule("slow").interval)
+	}
+
+	go scheduler.evaluate(scheduler.rule("slow"), time.Now())
+	<-slow.received
+
+	evaluated := make(chan struct{})
+	go func() {
+		scheduler.evaluate(scheduler.rule("fast"), time.Now())
+		close(evaluated)
+	}()
+	select {
+	case <-evaluated:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected rule fast to be evaluated while rule slow is sending")
+	}
+	close(slow.release)
+
+	if len(fast.open) != 1 || fast.open[0].NewAlerts[0].Id != "fast" {
+		t.Errorf("expected the alert of rule fast, got %v", fast.open)
+	}
+}
+
+func TestWorkersLimitConcurrentEvaluations(t *testing.T) {
+
+	slow, fast := newBlockingChannel(), newBlockingChannel()
+	scheduler := newTestScheduler(t, 1, map[string]Channel{"slow": slow, "fast": fast}, map[string]Rule{
+		"slow": {Channels: []string{"slow"}},
+		"fast": {Channels: []string{"fast"}},
+	})
+
+	go scheduler.evaluate(scheduler.rule("slow"), time.Now())
+	<-slow.received
+	go scheduler.evaluate(scheduler.rule("fast"), time.Now())
+
+	select {
+	case <-fast.received:
+		t.Fatalf("expected rule fast to wait for the only worker")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(slow.release)
+	close(fast.release)
+	select {
+	case <-fast.received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected rule fast to be evaluated when the worker is available")
+	}
+}
+
+func TestChannelsOfARuleAreSentInParallel(t *testing.T) {
+
+	slow, fast := newBlockingChannel(), newBlockingChannel()
+	scheduler := newTestScheduler(t, 1, map[string]Channel{"slow": slow, "fast": fast}, map[string]Rule{
+		"webshop": {Channels: []string{"slow", "fast"}},
+	})
+
+	go scheduler.evaluate(scheduler.rule("webshop"), time.Now())
+	for _, channel := range []*blockingChannel{slow, fast} {
+		select {
+		case <-channel.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected both channels to receive the alert at the same time")
+		}
+	}
+	close(slow.release)
+	close(fast.release)
+}
+
+// run with -race: the inhibit rule reads the attributes of the alerts of rule a while rule a records its notifications.
+// Logging is discarded, the lock of the logger would hide the race.
+func TestSnapshotsDoNotShareAlertsWithEvaluations(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	scheduler := newTestScheduler(t, 100, map[string]Channel{"a": &recordingChannel{}, "b": &recordingChannel{}}, map[string]Rule{
+		"a": {Channels: []string{"a"}},
+		"b": {Channels: []string{"b"}},
+	})
+	scheduler.inhibitRules = []InhibitRule{{SourceMatch: map[string]string{"severity": "major"}, Equal: []string{"notifications a"}}}
+
+	// evaluates the rules like evaluate does, without fetching the alerts from Alerta
+	var evaluations sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		evaluations.Add(1)
+		go func(handler *RuleHandler) {
+			defer evaluations.Done()
+			for i := 0; i < 100; i++ {
+				alerts := []Alert{{Id: handler.ruleName, Severity: "major", Attributes: map[string]string{}}}
+				handler.handle(time.Now(), alerts, scheduler.updateSnapshot(handler.ruleName, alerts))
+			}
+		}(scheduler.rule(name).handler)
+	}
+	evaluations.Wait()
+
+	// the notifications recorded after the snapshot don't change it
+	alerts := []Alert{{Id: "a", Severity: "major", Attributes: map[string]string{}}}
+	scheduler.updateSnapshot("a", alerts)
+	alerts[0].Notified("a")
+	target := Alert{Id: "c", Severity: "minor", Attributes: map[string]string{}}
+	if _, inhibited := scheduler.updateSnapshot("b", []Alert{}).InhibitedBy(target); !inhibited {
+		t.Fatalf("expected the alert to be inhibited by the snapshot of rule a")
+	}
+}
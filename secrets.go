@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// ${NAME} references to environment variables in the configuration values
+var environmentReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// channel config properties holding secrets, they can be read from a file with the _file suffix, e.g. token_file
+var channelSecrets = []string{"webhook_url", "token"}
+
+// Secret is a configuration value that must not end up in the logs, it is printed as ****** when set
+type Secret string
+
+func (secret Secret) String() string {
+	if secret == "" {
+		return ""
+	}
+	return "******"
+}
+
+func (secret Secret) GoString() string {
+	return fmt.Sprintf("%q", secret.String())
+}
+
+// channel configs are printed with their secrets redacted
+func (channel ChannelConfig) String() string {
+	return fmt.Sprintf("{%v %v}", channel.Type, channel.redacted())
+}
+
+func (channel ChannelConfig) GoString() string {
+	return fmt.Sprintf("main.ChannelConfig{Type:%q, Config:%#v}", channel.Type, channel.redacted())
+}
+
+func (channel ChannelConfig) redacted() map[string]string {
+	config := make(map[string]string, len(channel.Config))
+	for key, value := range channel.Config {
+		config[key] = value
+		for _, secret := range channelSecrets {
+			if key == secret {
+				config[key] = Secret(value).String()
+			}
+		}
+	}
+	return config
+}
+
+// resolveSecrets expands the environment variables in all values of the configuration
+// and reads the secrets that are configured with a *_file property
+func resolveSecrets(config *Config) error {
+
+	if err := expandEnvironment(reflect.ValueOf(config).Elem(), "config"); err != nil {
+		return err
+	}
+
+	if err := readSecretFile(&config.Alerta.ApiToken, config.Alerta.ApiTokenFile, "alerta.apiToken"); err != nil {
+		return err
+	}
+	if err := resolveSmtpSecrets(&config.ChannelSettings.Smtp, "channel_settings.smtp"); err != nil {
+		return err
+	}
+	for name, settings := range config.ChannelSettings.SmtpProfiles {
+		if err := resolveSmtpSecrets(&settings, "channel_settings.smtp_profiles."+name); err != nil {
+			return err
+		}
+		config.ChannelSettings.SmtpProfiles[name] = settings
+	}
+	if err := resolveSlackSecrets(&config.ChannelSettings.Slack, "channel_settings.slack"); err != nil {
+		return err
+	}
+	for name, settings := range config.ChannelSettings.SlackWorkspaces {
+		if err := resolveSlackSecrets(&settings, "channel_settings.slack_workspaces."+name); err != nil {
+			return err
+		}
+		config.ChannelSettings.SlackWorkspaces[name] = settings
+	}
+
+	for name, channel := range config.Channels {
+		for _, key := range channelSecrets {
+			filename, ok := channel.Config[key+"_file"]
+			if !ok {
+				continue
+			}
+			secret := Secret(channel.Config[key])
+			if err := readSecretFile(&secret, filename, fmt.Sprintf("channels.%v.config.%v", name, key)); err != nil {
+				return err
+			}
+			channel.Config[key] = string(secret)
+		}
+	}
+	return nil
+}
+
+func resolveSmtpSecrets(settings *Smtp, path string) error {
+	return readSecretFile(&settings.Password, settings.PasswordFile, path+".password")
+}
+
+func resolveSlackSecrets(settings *Slack, path string) error {
+	if err := readSecretFile(&settings.WebhookUrl, settings.WebhookUrlFile, path+".webhook_url"); err != nil {
+		return err
+	}
+	if err := readSecretFile(&settings.Token, settings.TokenFile, path+".token"); err != nil {
+		return err
+	}
+	return readSecretFile(&settings.SigningSecret, settings.SigningSecretFile, path+".signing_secret")
+}
+
+// reads the secret from the file, without its trailing line break, when a file is configured
+func readSecretFile(secret *Secret, filename string, path string) error {
+	if filename == "" {
+		return nil
+	}
+	if *secret != "" {
+		return errors.New(fmt.Sprintf("%v is configured twice: set either %v or %v_file", path, path, path))
+	}
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot read %v_file: %v", path, err))
+	}
+	*secret = Secret(strings.TrimRight(string(raw), "\r\n"))
+	return nil
+}
+
+// expands the ${NAME} references in all strings of the value, unset environment variables are an error
+func expandEnvironment(value reflect.Value, path string) error {
+	switch value.Kind() {
+	case reflect.String:
+		expanded, err := expandReferences(value.String())
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v: %v", path, err))
+		}
+		value.SetString(expanded)
+	case reflect.Struct:
+		for index := 0; index < value.NumField(); index++ {
+			field := value.Type().Field(index)
+			if field.PkgPath != "" {
+				continue
+			}
+			if err := expandEnvironment(value.Field(index), path+"."+yamlName(field)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for index := 0; index < value.Len(); index++ {
+			if err := expandEnvironment(value.Index(index), fmt.Sprintf("%v[%v]", path, index)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			// map values can't be modified in place
+			item := reflect.New(value.Type().Elem()).Elem()
+			item.Set(value.MapIndex(key))
+			if err := expandEnvironment(item, fmt.Sprintf("%v.%v", path, key)); err != nil {
+				return err
+			}
+			value.SetMapIndex(key, item)
+		}
+	}
+	return nil
+}
+
+func expandReferences(text string) (string, error) {
+	var missing []string
+	expanded := environmentReference.ReplaceAllStringFunc(text, func(reference string) string {
+		name := environmentReference.FindStringSubmatch(reference)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", errors.New(fmt.Sprintf("environment variable %v is not set", strings.Join(missing, ", ")))
+	}
+	return expanded, nil
+}
+
+// the yaml key of a struct field
+func yamlName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("yaml"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
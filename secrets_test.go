@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvironmentAndSecretFiles(t *testing.T) {
+
+	directory := t.TempDir()
+
+	ioutil.WriteFile(filepath.Join(directory, "password"), []byte("smtp-secret\n"), 0600)
+	ioutil.WriteFile(filepath.Join(directory, "token"), []byte("xoxb-file"), 0600)
+	setenv(t, "TEST_ALERTA_TOKEN", "alerta-secret")
+	setenv(t, "TEST_SECRETS_DIRECTORY", directory)
+
+	filename := filepath.Join(directory, "config.yml")
+	ioutil.WriteFile(filename, []byte(`
+alerta:
+  endpoint: http://alerta:8080/api
+  reload_interval: 60
+  apiToken: ${TEST_ALERTA_TOKEN}
+channel_settings:
+  smtp:
+    user: alerta@${TEST_ALERTA_TOKEN}.example.com
+    password_file: ${TEST_SECRETS_DIRECTORY}/password
+channels:
+  support:
+    type: slack
+    config:
+      slack_channel: '#support'
+      token_file: ${TEST_SECRETS_DIRECTORY}/token
+`), 0600)
+
+	config, err := Load(filename)
+	if err != nil {
+		t.Fatalf("cannot load config: %v", err)
+	}
+	if config.Alerta.ApiToken != "alerta-secret" || config.ChannelSettings.Smtp.User != "alerta@alerta-secret.example.com" {
+		t.Errorf("expected environment variables to be expanded, got %v and %v", string(config.Alerta.ApiToken), config.ChannelSettings.Smtp.User)
+	}
+	if config.ChannelSettings.Smtp.Password != "smtp-secret" || config.Channels["support"].Config["token"] != "xoxb-file" {
+		t.Errorf("expected secrets to be read from their files, got %v and %v", string(config.ChannelSettings.Smtp.Password), config.Channels["support"].Config["token"])
+	}
+
+	printed := fmt.Sprintf("%v %+v %#v", config, config, config)
+	for _, secret := range []string{"alerta-secret\"", "alerta-secret}", "smtp-secret", "xoxb-file"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("expected secret %v to be redacted in %v", secret, printed)
+		}
+	}
+
+	os.Unsetenv("TEST_ALERTA_TOKEN")
+	if _, err := Load(filename); err == nil || !strings.Contains(err.Error(), "TEST_ALERTA_TOKEN is not set") {
+		t.Errorf("expected error for unset environment variable, got %v", err)
+	}
+}
+
+// sets an environment variable for the duration of the test, its previous value is restored afterwards
+func setenv(t *testing.T, name string, value string) {
+	previous, set := os.LookupEnv(name)
+	t.Cleanup(func() {
+		if set {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+	os.Setenv(name, value)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultSeverityColor = "#343a40"
+	defaultSeverityEmoji = ":grey_question:"
+)
+
+// the Alerta severities from most to least severe
+var defaultSeverities = []Severity{
+	{Name: "security", DisplayName: "Security", Color: "#6f42c1", Emoji: ":rotating_light:"},
+	{Name: "critical", DisplayName: "Critical", Color: "#dc3545", Emoji: ":red_circle:"},
+	{Name: "major", DisplayName: "Major", Color: "#dc3545", Emoji: ":large_orange_diamond:"},
+	{Name: "minor", DisplayName: "Minor", Color: "#ffc107", Emoji: ":large_yellow_circle:"},
+	{Name: "warning", DisplayName: "Warning", Color: "#17a2b8", Emoji: ":warning:"},
+	{Name: "indeterminate", DisplayName: "Indeterminate", Color: "#6c757d", Emoji: ":grey_question:"},
+	{Name: "informational", DisplayName: "Informational", Color: "#007bff", Emoji: ":information_source:"},
+	{Name: "normal", DisplayName: "Normal", Color: "#28a745", Emoji: ":white_check_mark:"},
+	{Name: "ok", DisplayName: "OK", Color: "#28a745", Emoji: ":white_check_mark:"},
+	{Name: "cleared", DisplayName: "Cleared", Color: "#28a745", Emoji: ":white_check_mark:"},
+	{Name: "debug", DisplayName: "Debug", Color: "#343a40", Emoji: ":beetle:"},
+	{Name: "trace", DisplayName: "Trace", Color: "#343a40", Emoji: ":mag:"},
+}
+
+// the severity model used by the alerts and templates, configured at startup with LoadSeverities
+var severities = NewSeverityModel(defaultSeverities)
+
+// SeverityModel orders the severities from most to least severe and knows how to display them
+type SeverityModel struct {
+	levels []Severity
+	ranks  map[string]int
+}
+
+func NewSeverityModel(levels []Severity) SeverityModel {
+	ranks := make(map[string]int, len(levels))
+	for rank, level := range levels {
+		ranks[level.Name] = rank
+	}
+	return SeverityModel{levels: levels, ranks: ranks}
+}
+
+// LoadSeverities configures the severity model and checks the minimum severities of the rules.
+// Configured severities without colour, emoji or display name get the ones of the Alerta severity with the same name.
+func LoadSeverities(config Config) error {
+
+	defaults := NewSeverityModel(defaultSeverities)
+	model := defaults
+	if len(config.Severities) > 0 {
+		levels := make([]Severity, 0, len(config.Severities))
+		configured := make(map[string]bool)
+		for _, level := range config.Severities {
+			if level.Name == "" {
+				return errors.New("severity without name")
+			}
+			if configured[level.Name] {
+				return errors.New(fmt.Sprintf("severity '%v' is configured more than once", level.Name))
+			}
+			configured[level.Name] = true
+			if defaults.Known(level.Name) {
+				level.Color = getOrElse(level.Color, defaults.Color(level.Name))
+				level.Emoji = getOrElse(level.Emoji, defaults.Emoji(level.Name))
+				level.DisplayName = getOrElse(level.DisplayName, defaults.DisplayName(level.Name))
+			}
+			levels = append(levels, level)
+		}
+		model = NewSeverityModel(levels)
+	}
+
+	for ruleName, rule := range config.Rules {
+		if rule.MinSeverity != "" && !model.Known(rule.MinSeverity) {
+			return errors.New(fmt.Sprintf("unknown min_severity '%v' of rule '%v': valid severities are %v", rule.MinSeverity, ruleName, strings.Join(model.Names(), ", ")))
+		}
+	}
+
+	severities = model
+	return nil
+}
+
+func (model SeverityModel) Known(name string) bool {
+	_, ok := model.ranks[name]
+	return ok
+}
+
+// Rank of the severity, 0 is the most severe and unknown severities rank last
+func (model SeverityModel) Rank(name string) int {
+	if rank, ok := model.ranks[name]; ok {
+		return rank
+	}
+	return len(model.levels)
+}
+
+// AtLeast is true when the severity is as severe as the minimum severity, or more
+func (model SeverityModel) AtLeast(name string, minimum string) bool {
+	return model.Rank(name) <= model.Rank(minimum)
+}
+
+func (model SeverityModel) Names() []string {
+	names := make([]string, 0, len(model.levels))
+	for _, level := range model.levels {
+		names = append(names, level.Name)
+	}
+	return names
+}
+
+func (model SeverityModel) Color(name string) string {
+	return getOrElse(model.level(name).Color, defaultSeverityColor)
+}
+
+func (model SeverityModel) Emoji(name string) string {
+	return getOrElse(model.level(name).Emoji, defaultSeverityEmoji)
+}
+
+func (model SeverityModel) DisplayName(name string) string {
+	return getOrElse(model.level(name).DisplayName, name)
+}
+
+func (model SeverityModel) level(name string) Severity {
+	if rank, ok := model.ranks[name]; ok {
+		return model.levels[rank]
+	}
+	return Severity{Name: name}
+}
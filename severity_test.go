@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConfiguredSeverities(t *testing.T) {
+
+	defer func() { severities = NewSeverityModel(defaultSeverities) }()
+
+	config := Config{
+		Severities: []Severity{
+			{Name: "page", DisplayName: "Page the on-call", Color: "#ff0000", Emoji: ":pager:"},
+			{Name: "critical", Color: "#990000"},
+			{Name: "warning"},
+		},
+		Rules: map[string]Rule{"oncall": {MinSeverity: "critical"}},
+	}
+	if err := LoadSeverities(config); err != nil {
+		t.Fatalf("cannot load severities: %v", err)
+	}
+
+	page := Alert{Severity: "page"}
+	critical := Alert{Severity: "critical"}
+	if page.Color() != "#ff0000" || page.SeverityName() != "Page the on-call" || page.Emoji() != ":pager:" {
+		t.Fatalf("unexpected display of custom severity: %v %v %v", page.Color(), page.SeverityName(), page.Emoji())
+	}
+	if critical.Color() != "#990000" || critical.SeverityName() != "Critical" || critical.Emoji() != ":red_circle:" {
+		t.Fatalf("expected configured colour and default display of critical: %v %v %v", critical.Color(), critical.SeverityName(), critical.Emoji())
+	}
+	if !severities.AtLeast("page", "critical") || severities.AtLeast("warning", "critical") || severities.AtLeast("major", "warning") {
+		t.Fatalf("unexpected severity ordering %v", severities.Names())
+	}
+
+	config.Rules["oncall"] = Rule{MinSeverity: "major"}
+	if err := LoadSeverities(config); err == nil {
+		t.Fatalf("expected error for unknown minimum severity")
+	}
+	config.Severities = append(config.Severities, Severity{Name: "page"})
+	if err := LoadSeverities(Config{Severities: config.Severities}); err == nil {
+		t.Fatalf("expected error for duplicate severity")
+	}
+}
+
+func TestDefaultSeverities(t *testing.T) {
+
+	for _, severity := range []string{"security", "informational", "debug", "trace", "indeterminate", "ok", "normal", "cleared"} {
+		if !severities.Known(severity) || (&Alert{Severity: severity}).Color() == defaultSeverityColor && severity != "debug" && severity != "trace" {
+			t.Errorf("expected a colour for Alerta severity %v", severity)
+		}
+	}
+	if severities.Rank("unknown") != len(defaultSeverities) {
+		t.Errorf("expected unknown severities to rank last")
+	}
+}
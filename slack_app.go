@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"log"
+	"sync"
+)
+
+// message posted for the alert by a channel, as "<slack channel id> <message ts> <number of alerts in the message>"
+const slack_message_attribute_format = "slack message %s"
+
+// SlackAppChannel posts alerts with a Slack bot token through the Web API instead of a webhook.
+// Every alert (or group of alerts) gets its own message, follow-up messages are threaded under it
+// and the original message is updated in place when its alerts are closed.
+// The posted messages are recorded in the alert attributes, so this still works after a restart.
+type SlackAppChannel struct {
+	SlackChannel
+
+	name   string
+	client *slack.Client
+
+	mutex    *sync.Mutex
+	messages map[string]*slackMessage // posted messages by alert id
+}
+
+// a message posted for one or more alerts
+type slackMessage struct {
+	channel string
+	ts      string
+	group   string
+	alerts  []Alert
+	open    int // number of alerts of the message that are still open
+
+	// restored from the alert attributes after a restart, alerts only holds the alerts closed since then
+	restored bool
+}
+
+func NewSlackAppChannel(channelName string, slackChannel SlackChannel, options ...slack.Option) SlackAppChannel {
+	return SlackAppChannel{
+		SlackChannel: slackChannel,
+		name:         channelName,
+		client:       slack.New(string(slackChannel.settings.Token), options...),
+		mutex:        &sync.Mutex{},
+		messages:     make(map[string]*slackMessage),
+	}
+}
+
+func (app SlackAppChannel) SendOpenAlerts(event OpenAlertsEvent, dryrun bool) error {
+
+	if event.Storm {
+		return app.postEvent(event, "", dryrun)
+	}
+
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	if event.Group != "" {
+		return app.postAlerts(event, dryrun)
+	}
+
+	// without grouping every alert gets its own message, inhibited alerts are listed with the first one
+	for index, alert := range event.NewAlerts {
+		single := OpenAlertsEvent{NewAlertCount: 1, NewAlerts: []Alert{alert}, AlreadyNotified: event.AlreadyNotified, AlertaUrl: event.AlertaUrl}
+		if index == 0 {
+			single.Inhibited = event.Inhibited
+		}
+		if err := app.postAlerts(single, dryrun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app SlackAppChannel) postAlerts(event OpenAlertsEvent, dryrun bool) error {
+
+	msg, renderError := event.toWebhookMessage(app.SlackChannel)
+	channel, ts, err := app.post(msg, "", dryrun)
+	if err != nil || dryrun {
+		return fallbackError(renderError, err)
+	}
+
+	message := &slackMessage{channel: channel, ts: ts, group: event.Group, alerts: event.NewAlerts, open: len(event.NewAlerts)}
+	for _, alert := range event.NewAlerts {
+		app.messages[alert.Id] = message
+		app.recordMessage(alert, message)
+	}
+	return fallbackError(renderError, nil)
+}
+
+// records the message in the attributes of the alert, Alerta merges them with the other attributes of the alert
+func (app SlackAppChannel) recordMessage(alert Alert, message *slackMessage) {
+	attributes := map[string]string{
+		fmt.Sprintf(slack_message_attribute_format, app.name): fmt.Sprintf("%v %v %v", message.channel, message.ts, len(message.alerts)),
+	}
+	alerta := AlertaClient{config: app.Alerta}
+	if err := alerta.updateAttributes(Alert{Id: alert.Id, Attributes: attributes}, false); err != nil {
+		log.Printf("Error recording slack message %v of channel '%v' for alert '%v': %v", message.ts, app.name, alert.Id, err)
+	}
+}
+
+// returns the message posted for the alert, messages posted before a restart are restored from the alert attributes
+func (app SlackAppChannel) message(alert Alert) (*slackMessage, bool) {
+
+	if message, ok := app.messages[alert.Id]; ok {
+		return message, true
+	}
+
+	var channel, ts string
+	var size int
+	recorded := alert.Attributes[fmt.Sprintf(slack_message_attribute_format, app.name)]
+	if _, err := fmt.Sscanf(recorded, "%s %s %d", &channel, &ts, &size); err != nil {
+		return nil, false
+	}
+	for _, message := range app.messages {
+		if message.channel == channel && message.ts == ts {
+			app.messages[alert.Id] = message
+			return message, true
+		}
+	}
+	message := &slackMessage{channel: channel, ts: ts, alerts: make([]Alert, 0), open: size, restored: true}
+	app.messages[alert.Id] = message
+	return message, true
+}
+
+func (app SlackAppChannel) SendClosedAlerts(event ClosedAlertsEvent, dryrun bool) error {
+
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	// closed alerts without a known message (e.g. notified before they were recorded) are posted as a new message
+	unknown := make([]Alert, 0)
+	closedByMessage := make(map[*slackMessage][]Alert)
+	messages := make([]*slackMessage, 0)
+
+	for _, alert := range event.Alerts {
+		message, ok := app.message(alert)
+		if !ok {
+			unknown = append(unknown, alert)
+			continue
+		}
+		delete(app.messages, alert.Id)
+		message.open--
+		if message.restored {
+			message.alerts = append(message.alerts, alert)
+		}
+		if _, ok := closedByMessage[message]; !ok {
+			messages = append(messages, message)
+		}
+		closedByMessage[message] = append(closedByMessage[message], alert)
+	}
+
+	if event.Storm {
+		return app.postEvent(event, "", dryrun)
+	}
+
+	for _, message := range messages {
+
+		if message.open <= 0 {
+			// all alerts of the original message are closed: mark the message itself as resolved
+			resolved := ClosedAlertsEvent{Group: message.group, Alerts: message.alerts, AlertaUrl: event.AlertaUrl}
+			msg, renderError := resolved.toWebhookMessage(app.SlackChannel)
+			if err := fallbackError(renderError, app.update(message, msg, dryrun)); err != nil {
+				return err
+			}
+		} else {
+			closed := ClosedAlertsEvent{Group: message.group, Alerts: closedByMessage[message], AlertaUrl: event.AlertaUrl}
+			if err := app.postEvent(closed, message.ts, dryrun); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(unknown) > 0 {
+		closed := ClosedAlertsEvent{Group: event.Group, GroupLabels: event.GroupLabels, Alerts: unknown, AlertaUrl: event.AlertaUrl}
+		return app.postEvent(closed, "", dryrun)
+	}
+	return nil
+}
+
+func (app SlackAppChannel) SendFlappingAlerts(event FlappingAlertsEvent, dryrun bool) error {
+
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	unknown := make([]Alert, 0)
+	for _, alert := range event.Alerts {
+		if message, ok := app.message(alert); ok {
+			if err := app.postEvent(FlappingAlertsEvent{Alerts: []Alert{alert}}, message.ts, dryrun); err != nil {
+				return err
+			}
+		} else {
+			unknown = append(unknown, alert)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return app.postEvent(FlappingAlertsEvent{Alerts: unknown}, "", dryrun)
+	}
+	return nil
+}
+
+// severity changes are threaded under the message of the alert, when it is known
+func (app SlackAppChannel) SendSeverityChanged(event SeverityChangedEvent, dryrun bool) error {
+
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+
+	unknown := make([]Alert, 0)
+	for _, alert := range event.Alerts {
+		if message, ok := app.message(alert); ok {
+			changed := SeverityChangedEvent{Alerts: []Alert{alert}, Previous: event.Previous, Increased: event.Increased, AlertaUrl: event.AlertaUrl}
+			if err := app.postEvent(changed, message.ts, dryrun); err != nil {
+				return err
+			}
+		} else {
+			unknown = append(unknown, alert)
+		}
+	}
+
+	if len(unknown) > 0 {
+		changed := SeverityChangedEvent{Group: event.Group, GroupLabels: event.GroupLabels, Alerts: unknown, Previous: event.Previous, Increased: event.Increased, AlertaUrl: event.AlertaUrl}
+		return app.postEvent(changed, "", dryrun)
+	}
+	return nil
+}
+
+// slackEvent is implemented by all events that can be rendered as a Slack message
+type slackEvent interface {
+	toWebhookMessage(slackChannel SlackChannel) (slack.WebhookMessage, error)
+}
+
+func (app SlackAppChannel) postEvent(event slackEvent, threadTs string, dryrun bool) error {
+	msg, renderError := event.toWebhookMessage(app.SlackChannel)
+	_, _, err := app.post(msg, threadTs, dryrun)
+	return fallbackError(renderError, err)
+}
+
+// posts a message, as a thread reply when threadTs is set, and returns the channel id and timestamp of the message
+func (app SlackAppChannel) post(msg slack.WebhookMessage, threadTs string, dryrun bool) (string, string, error) {
+
+	msg.ThreadTimestamp = threadTs
+
+	if dryrun {
+		log.Print("-- DryRun is active: not really posting to slack --")
+		return "", "", logSlackMessage(msg)
+	}
+
+	log.Printf("Posting msg to slack channel %v: %v", app.Channel, msg.Text)
+	return app.client.PostMessage(app.Channel, messageOptions(msg)...)
+}
+
+func (app SlackAppChannel) update(message *slackMessage, msg slack.WebhookMessage, dryrun bool) error {
+
+	if dryrun {
+		log.Printf("-- DryRun is active: not really updating slack message %v --", message.ts)
+		return logSlackMessage(msg)
+	}
+
+	log.Printf("Updating slack message %v in channel %v: %v", message.ts, message.channel, msg.Text)
+	_, _, _, err := app.client.UpdateMessage(message.channel, message.ts, messageOptions(msg)...)
+	return err
+}
+
+func messageOptions(msg slack.WebhookMessage) []slack.MsgOption {
+
+	options := []slack.MsgOption{
+		slack.MsgOptionText(msg.Text, false),
+		slack.MsgOptionAttachments(msg.Attachments...),
+	}
+	if msg.Blocks != nil {
+		options = append(options, slack.MsgOptionBlocks(msg.Blocks.BlockSet...))
+	}
+	if msg.IconEmoji != "" {
+		options = append(options, slack.MsgOptionIconEmoji(msg.IconEmoji))
+	}
+	if msg.Username != "" {
+		options = append(options, slack.MsgOptionUsername(msg.Username))
+	}
+	if msg.ThreadTimestamp != "" {
+		options = append(options, slack.MsgOptionTS(msg.ThreadTimestamp))
+	}
+	return options
+}
+
+func logSlackMessage(msg slack.WebhookMessage) error {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshalling slack message to json: %v", err)
+		return err
+	}
+	log.Printf("Posting slack message:\n%v", string(raw))
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlackAppThreadsAndUpdatesMessages(t *testing.T) {
+
+	calls := make([]string, 0)
+	recorded := make(map[string]map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/alert/") {
+			var body struct{ Attributes map[string]string }
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("cannot parse alerta attributes request: %v", err)
+			}
+			recorded[strings.Split(r.URL.Path, "/")[2]] = body.Attributes
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("cannot parse slack api request: %v", err)
+		}
+		calls = append(calls, fmt.Sprintf("%v ts=%v thread_ts=%v", r.URL.Path, r.Form.Get("ts"), r.Form.Get("thread_ts")))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"ok": true, "channel": "C123", "ts": "%v.000"}`, len(calls))
+	}))
+	defer server.Close()
+
+	slackChannel := SlackChannel{Alerta: Alerta{Endpoint: server.URL}, Channel: "#test", settings: Slack{Token: "xoxb-test"}}
+	app := NewSlackAppChannel("slack", slackChannel, slack.OptionAPIURL(server.URL+"/"))
+	alerts := readAlerts(t)
+
+	if err := app.SendOpenAlerts(OpenAlertsEvent{NewAlertCount: 2, NewAlerts: alerts[:2]}, false); err != nil {
+		t.Fatalf("cannot post open alerts: %v", err)
+	}
+	if err := app.SendFlappingAlerts(FlappingAlertsEvent{Alerts: alerts[1:2]}, false); err != nil {
+		t.Fatalf("cannot post flapping alerts: %v", err)
+	}
+	if err := app.SendClosedAlerts(ClosedAlertsEvent{Alerts: alerts[:1]}, false); err != nil {
+		t.Fatalf("cannot post closed alerts: %v", err)
+	}
+
+	expected := []string{
+		"/chat.postMessage ts= thread_ts=",
+		"/chat.postMessage ts= thread_ts=",
+		"/chat.postMessage ts= thread_ts=2.000",
+		"/chat.update ts=1.000 thread_ts=",
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected slack api calls %v, expected %v", calls, expected)
+	}
+
+	// after a restart the messages are restored from the alert attributes
+	restarted := NewSlackAppChannel("slack", slackChannel, slack.OptionAPIURL(server.URL+"/"))
+	open := alerts[1]
+	open.Attributes = recorded[open.Id]
+	if open.Attributes["slack message slack"] != "C123 2.000 1" {
+		t.Fatalf("expected the message to be recorded in the alert attributes, got %v", open.Attributes)
+	}
+
+	calls = calls[:0]
+	if err := restarted.SendClosedAlerts(ClosedAlertsEvent{Alerts: []Alert{open}}, false); err != nil {
+		t.Fatalf("cannot post closed alerts: %v", err)
+	}
+	if fmt.Sprint(calls) != "[/chat.update ts=2.000 thread_ts=]" {
+		t.Fatalf("expected the message posted before the restart to be updated, got %v", calls)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"gopkg.in/yaml.v3"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// renderMessage renders a Slack message template into a webhook message. The template produces the
+// JSON (or, for .yml/.yaml/.goyaml templates, YAML) of a message with Block Kit blocks and/or attachments.
+// When the template can't be rendered, a plain text fallback message is returned together with the error.
+func (slackChannel SlackChannel) renderMessage(filename string, event alertEvent) (slack.WebhookMessage, error) {
+	msg, err := slackChannel.renderTemplate(filename, event)
+	if err != nil {
+		return slack.WebhookMessage{Channel: slackChannel.Channel, Text: fallbackText(event)}, err
+	}
+	return msg, nil
+}
+
+func (slackChannel SlackChannel) renderTemplate(filename string, event alertEvent) (slack.WebhookMessage, error) {
+
+	var msg slack.WebhookMessage
+	var result bytes.Buffer
+
+	filename = localizedTemplate(filename, slackChannel.Language)
+	t, parseError := templates.textTemplate(filename, slackChannel.templateFuncs())
+	if parseError != nil {
+		return msg, fmt.Errorf("cannot load slack template %v: %v", filename, parseError)
+	}
+	if err := t.Execute(&result, event); err != nil {
+		return msg, fmt.Errorf("cannot render slack template %v: %v", filename, err)
+	}
+
+	raw := result.Bytes()
+	if isYamlTemplate(filename) {
+		var err error
+		if raw, err = yamlToJson(raw); err != nil {
+			return msg, fmt.Errorf("slack template %v does not render valid yaml: %v", filename, err)
+		}
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return msg, fmt.Errorf("slack template %v does not render a valid message: %v", filename, err)
+	}
+	if msg.Channel == "" {
+		msg.Channel = slackChannel.Channel
+	}
+	return msg, nil
+}
+
+// parses all templates of the channel, so broken or missing templates are reported at startup
+func (slackChannel SlackChannel) validateTemplates() error {
+	filenames := []string{
+		getOrElse(slackChannel.TemplateOpen, "templates/slack_open_alerts.gojson"),
+		getOrElse(slackChannel.TemplateClosed, "templates/slack_closed_alerts.gojson"),
+		getOrElse(slackChannel.TemplateFlapping, "templates/slack_flapping_alerts.gojson"),
+		getOrElse(slackChannel.TemplateSeverity, "templates/slack_severity_changed.gojson"),
+		"templates/slack_storm_alerts.gojson",
+	}
+	for _, filename := range filenames {
+		filename = localizedTemplate(filename, slackChannel.Language)
+		if _, err := templates.textTemplate(filename, slackChannel.templateFuncs()); err != nil {
+			return fmt.Errorf("invalid slack template %v: %v", filename, err)
+		}
+	}
+	return nil
+}
+
+func (slackChannel SlackChannel) templateFuncs() template.FuncMap {
+	funcs := template.FuncMap(alertFuncs(slackChannel.location, slackChannel.Language))
+	slackFuncs := template.FuncMap{
+		// quotes a value as json string, e.g. "text": {{ json .Text }}
+		"json": func(value interface{}) (string, error) {
+			raw, err := json.Marshal(value)
+			return string(raw), err
+		},
+		"channel": func() string {
+			return slackChannel.Channel
+		},
+		// true when the Ack, Shelve and Close buttons are enabled
+		"interactive": func() bool {
+			return slackChannel.settings.Interactive()
+		},
+		// json of the actions block with the buttons for an alert
+		"actions": func(alert Alert) (string, error) {
+			raw, err := json.Marshal(alertActions(alert))
+			return string(raw), err
+		},
+		// true when one of the alerts has one of the given severities, e.g. to mention <!here> for critical alerts
+		"anySeverity": func(alerts []Alert, names ...string) bool {
+			for _, alert := range alerts {
+				for _, severity := range names {
+					if alert.Severity == severity {
+						return true
+					}
+				}
+			}
+			return false
+		},
+		"now": func() int64 {
+			return time.Now().Unix()
+		},
+	}
+	for name, function := range slackFuncs {
+		funcs[name] = function
+	}
+	return funcs
+}
+
+func isYamlTemplate(filename string) bool {
+	extension := strings.ToLower(path.Ext(filename))
+	return extension == ".yml" || extension == ".yaml" || extension == ".goyaml"
+}
+
+func yamlToJson(raw []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonCompatible(value))
+}
+
+// yaml decodes maps with keys that aren't all strings as map[interface{}]interface{}, which can't be marshalled to json
+func jsonCompatible(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = jsonCompatible(item)
+		}
+		return typed
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			result[fmt.Sprint(key)] = jsonCompatible(item)
+		}
+		return result
+	case []interface{}:
+		for index, item := range typed {
+			typed[index] = jsonCompatible(item)
+		}
+		return typed
+	default:
+		return value
+	}
+}
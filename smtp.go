@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TlsNone     = "none"
+	TlsStartTls = "starttls"
+	TlsImplicit = "implicit"
+
+	defaultSmtpTimeout = 30 * time.Second
+	smtpIdleTimeout    = 15 * time.Second
+)
+
+// SmtpPool keeps smtp connections open so mails of different channels sent during the same evaluation cycle
+// reuse the connection to the same server. Connections are closed when they have been idle for a while.
+type SmtpPool struct {
+	mutex       sync.Mutex
+	connections map[smtpPoolKey]*smtpConnection
+}
+
+// all settings that affect how a connection is dialed and authenticated, only connections with the same settings are shared
+type smtpPoolKey struct {
+	server             string
+	port               int
+	tls                string
+	caFile             string
+	insecureSkipVerify bool
+	timeout            Duration
+	anonymous          bool
+	auth               string
+	user               string
+	password           Secret
+}
+
+type smtpConnection struct {
+	mutex  sync.Mutex
+	conn   net.Conn
+	client *smtp.Client
+	idle   *time.Timer
+}
+
+func NewSmtpPool() *SmtpPool {
+	return &SmtpPool{connections: make(map[smtpPoolKey]*smtpConnection)}
+}
+
+// Send delivers the raw message to the recipients, over a pooled connection when one is available
+func (pool *SmtpPool) Send(settings Smtp, from string, to []string, msg []byte) error {
+
+	connection := pool.connection(poolKey(settings))
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	if connection.client != nil {
+		if err := connection.client.Reset(); err != nil {
+			log.Printf("Pooled smtp connection to %v is no longer usable, reconnecting: %v", settings.Server, err)
+			connection.close()
+		}
+	}
+	if connection.client == nil {
+		if err := connection.dial(settings); err != nil {
+			return err
+		}
+	}
+
+	err := connection.send(settings, from, to, msg)
+	if err != nil {
+		connection.close()
+		return err
+	}
+
+	if connection.idle != nil {
+		connection.idle.Stop()
+	}
+	connection.idle = time.AfterFunc(smtpIdleTimeout, func() {
+		connection.mutex.Lock()
+		defer connection.mutex.Unlock()
+		connection.quit()
+	})
+	return nil
+}
+
+func poolKey(settings Smtp) smtpPoolKey {
+	return smtpPoolKey{
+		server:             settings.Server,
+		port:               settings.Port,
+		tls:                settings.tlsMode(),
+		caFile:             settings.CaFile,
+		insecureSkipVerify: settings.InsecureSkipVerify,
+		timeout:            settings.Timeout,
+		anonymous:          settings.Anonymous,
+		auth:               settings.Auth,
+		user:               settings.User,
+		password:           settings.Password,
+	}
+}
+
+func (pool *SmtpPool) connection(key smtpPoolKey) *smtpConnection {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	connection, ok := pool.connections[key]
+	if !ok {
+		connection = &smtpConnection{}
+		pool.connections[key] = connection
+	}
+	return connection
+}
+
+// Close closes all pooled connections
+func (pool *SmtpPool) Close() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for _, connection := range pool.connections {
+		connection.mutex.Lock()
+		connection.quit()
+		connection.mutex.Unlock()
+	}
+}
+
+func (connection *smtpConnection) dial(settings Smtp) error {
+
+	addr := net.JoinHostPort(settings.Server, strconv.Itoa(settings.Port))
+	timeout := settings.timeout()
+
+	tlsConfig, tlsError := settings.tlsConfig()
+	if tlsError != nil {
+		return tlsError
+	}
+
+	var conn net.Conn
+	var err error
+	if settings.tlsMode() == TlsImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, settings.Server)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	connection.conn = conn
+	connection.client = client
+
+	if err := connection.startTls(settings, tlsConfig); err != nil {
+		connection.close()
+		return err
+	}
+
+	if auth := settings.auth(); auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			connection.close()
+			return errors.New(fmt.Sprintf("smtp server %v does not support authentication", settings.Server))
+		}
+		if err := client.Auth(auth); err != nil {
+			connection.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (connection *smtpConnection) startTls(settings Smtp, tlsConfig *tls.Config) error {
+	switch settings.tlsMode() {
+	case TlsStartTls:
+		if ok, _ := connection.client.Extension("STARTTLS"); !ok {
+			return errors.New(fmt.Sprintf("smtp server %v does not support STARTTLS", settings.Server))
+		}
+		return connection.client.StartTLS(tlsConfig)
+	case "":
+		// no explicit mode configured: use STARTTLS when the server supports it
+		if ok, _ := connection.client.Extension("STARTTLS"); ok {
+			return connection.client.StartTLS(tlsConfig)
+		}
+	}
+	return nil
+}
+
+func (connection *smtpConnection) send(settings Smtp, from string, to []string, msg []byte) error {
+
+	r := strings.NewReplacer("\r\n", "", "\r", "", "\n", "", "%0a", "", "%0d", "")
+
+	connection.conn.SetDeadline(time.Now().Add(settings.timeout()))
+
+	if err := connection.client.Mail(r.Replace(from)); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		address, err := mail.ParseAddress(r.Replace(recipient))
+		if err != nil {
+			return err
+		}
+		if err := connection.client.Rcpt(address.Address); err != nil {
+			return err
+		}
+	}
+
+	w, err := connection.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (connection *smtpConnection) quit() {
+	if connection.client != nil {
+		connection.client.Quit()
+		connection.close()
+	}
+}
+
+func (connection *smtpConnection) close() {
+	if connection.client != nil {
+		connection.client.Close()
+	}
+	connection.client = nil
+	connection.conn = nil
+}
+
+// tls mode of the smtp settings, for backwards compatibility 'ssl: true' means implicit tls
+// and anonymous relays without explicit mode don't use tls
+func (settings Smtp) tlsMode() string {
+	if settings.Tls != "" {
+		return strings.ToLower(settings.Tls)
+	}
+	if settings.Ssl {
+		return TlsImplicit
+	}
+	if settings.Anonymous {
+		return TlsNone
+	}
+	return ""
+}
+
+func (settings Smtp) tlsConfig() (*tls.Config, error) {
+
+	tlsConfig := &tls.Config{ServerName: settings.Server, InsecureSkipVerify: settings.InsecureSkipVerify}
+
+	if settings.CaFile != "" {
+		pem, err := ioutil.ReadFile(settings.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("no certificates found in ca_file %v", settings.CaFile))
+		}
+	}
+	return tlsConfig, nil
+}
+
+func (settings Smtp) timeout() time.Duration {
+	if settings.Timeout > 0 {
+		return time.Duration(settings.Timeout)
+	}
+	return defaultSmtpTimeout
+}
+
+// authentication mechanism of the smtp settings, nil for anonymous relays
+func (settings Smtp) auth() smtp.Auth {
+	if settings.Anonymous || settings.User == "" {
+		return nil
+	}
+	switch strings.ToUpper(settings.Auth) {
+	case "LOGIN":
+		return &loginAuth{username: settings.User, password: string(settings.Password)}
+	case "CRAM-MD5":
+		return smtp.CRAMMD5Auth(settings.User, string(settings.Password))
+	default:
+		return smtp.PlainAuth("", settings.User, string(settings.Password), settings.Server)
+	}
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which is not provided by net/smtp
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (auth *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (auth *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(auth.username), nil
+	case "password:":
+		return []byte(auth.password), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unexpected LOGIN challenge: %s", fromServer))
+	}
+}
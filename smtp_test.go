@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSmtpServer accepts smtp connections and records the received messages
+type fakeSmtpServer struct {
+	listener    net.Listener
+	mutex       sync.Mutex
+	connections int
+	messages    []string
+}
+
+func newFakeSmtpServer(t *testing.T) *fakeSmtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start fake smtp server: %v", err)
+	}
+	server := &fakeSmtpServer{listener: listener}
+	go server.serve()
+	return server
+}
+
+func (server *fakeSmtpServer) settings() Smtp {
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return Smtp{Server: host, Port: portNumber, From: "alerta@example.com", Anonymous: true, Tls: TlsNone}
+}
+
+func (server *fakeSmtpServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.mutex.Lock()
+		server.connections++
+		server.mutex.Unlock()
+		go server.handle(conn)
+	}
+}
+
+func (server *fakeSmtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 fake smtp")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 fake")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil || dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			server.mutex.Lock()
+			server.messages = append(server.messages, data.String())
+			server.mutex.Unlock()
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSmtpPoolReusesConnections(t *testing.T) {
+
+	server := newFakeSmtpServer(t)
+	defer server.listener.Close()
+
+	pool := NewSmtpPool()
+	for i := 0; i < 2; i++ {
+		if err := pool.Send(server.settings(), "alerta@example.com", []string{"Ops <ops@example.com>"}, []byte("Subject: test\r\n\r\nbody\r\n")); err != nil {
+			t.Fatalf("cannot send mail: %v", err)
+		}
+	}
+
+	// a profile for the same server and user that verifies tls differently gets its own connection
+	insecure := server.settings()
+	insecure.InsecureSkipVerify = true
+	if err := pool.Send(insecure, "alerta@example.com", []string{"Ops <ops@example.com>"}, []byte("Subject: test\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("cannot send mail: %v", err)
+	}
+	pool.Close()
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.connections != 2 || len(server.messages) != 3 {
+		t.Fatalf("expected 3 messages over 2 connections, got %v messages over %v connections", len(server.messages), server.connections)
+	}
+}
+
+func TestSmtpSettings(t *testing.T) {
+
+	if mode := (Smtp{Ssl: true}).tlsMode(); mode != TlsImplicit {
+		t.Fatalf("expected ssl to mean implicit tls, got %v", mode)
+	}
+	if auth := (Smtp{User: "user", Auth: "login"}).auth(); auth == nil {
+		t.Fatalf("expected LOGIN authentication")
+	}
+	if auth := (Smtp{User: "user", Anonymous: true}).auth(); auth != nil {
+		t.Fatalf("expected no authentication for anonymous relay")
+	}
+	if _, err := smtpSettings(ChannelSettings{Smtp: Smtp{Tls: "ssl"}}, "test", map[string]string{}); err == nil {
+		t.Fatalf("expected error for invalid tls mode")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// The default templates are embedded in the binary. A template file on disk with the same name,
+// relative to the directory of the template cache, takes precedence so the defaults can still be customized.
+//
+//go:embed templates
+var defaultTemplates embed.FS
+
+// parsed templates by filename, templates are parsed once and cloned for every execution
+var templates = newTemplateCache("")
+
+type templateCache struct {
+	directory string // relative template filenames are read from this directory, the working directory when empty
+
+	mutex sync.Mutex
+	html  map[string]*template.Template
+	text  map[string]*texttemplate.Template
+}
+
+func newTemplateCache(directory string) *templateCache {
+	return &templateCache{
+		directory: directory,
+		html:      make(map[string]*template.Template),
+		text:      make(map[string]*texttemplate.Template),
+	}
+}
+
+// clear drops the parsed templates, so they are read again on their next use
+func (cache *templateCache) clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.html = make(map[string]*template.Template)
+	cache.text = make(map[string]*texttemplate.Template)
+}
+
+// alertEvent is implemented by all events sent to the channels
+type alertEvent interface {
+	Subject() string
+	eventAlerts() []Alert
+}
+
+// path of the template file on disk
+func (cache *templateCache) path(filename string) string {
+	if cache.directory == "" || filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(cache.directory, filename)
+}
+
+func (cache *templateCache) read(filename string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(cache.path(filename))
+	if os.IsNotExist(err) {
+		if embedded, embeddedError := defaultTemplates.ReadFile(path.Clean(filename)); embeddedError == nil {
+			return embedded, nil
+		}
+	}
+	return raw, err
+}
+
+// exists tells whether there is a template file on disk or an embedded default template with the name
+func (cache *templateCache) exists(filename string) bool {
+	if _, err := os.Stat(cache.path(filename)); err == nil {
+		return true
+	}
+	_, err := fs.Stat(defaultTemplates, path.Clean(filename))
+	return err == nil
+}
+
+// htmlTemplate returns the parsed html template, ready to be executed with the given functions
+func (cache *templateCache) htmlTemplate(filename string, funcs template.FuncMap) (*template.Template, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	t, ok := cache.html[filename]
+	if !ok {
+		raw, err := cache.read(filename)
+		if err != nil {
+			return nil, err
+		}
+		if t, err = template.New(path.Base(filename)).Funcs(funcs).Parse(string(raw)); err != nil {
+			return nil, err
+		}
+		cache.html[filename] = t
+	}
+	clone, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.Funcs(funcs), nil
+}
+
+// textTemplate returns the parsed text template, ready to be executed with the given functions
+func (cache *templateCache) textTemplate(filename string, funcs texttemplate.FuncMap) (*texttemplate.Template, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	t, ok := cache.text[filename]
+	if !ok {
+		raw, err := cache.read(filename)
+		if err != nil {
+			return nil, err
+		}
+		if t, err = texttemplate.New(path.Base(filename)).Funcs(funcs).Parse(string(raw)); err != nil {
+			return nil, err
+		}
+		cache.text[filename] = t
+	}
+	clone, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.Funcs(funcs), nil
+}
+
+// plain text message listing the alerts of an event, used when the template of a channel can't be rendered
+func fallbackText(event alertEvent) string {
+	var text strings.Builder
+	text.WriteString(event.Subject())
+	text.WriteString("\n")
+	for _, alert := range event.eventAlerts() {
+		text.WriteString(fmt.Sprintf("\n- [%v] %v: %v (%v) %v", alert.Severity, alert.Resource, alert.Event, alert.Environment, alert.Url))
+	}
+	return text.String()
+}
+
+var (
+	invisibleHtml = regexp.MustCompile(`(?is)<(head|style|script)\b.*?</(head|style|script)>`)
+	lineBreakHtml = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|li|tr|table|ul|ol|pre)>`)
+	listItemHtml  = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	cellHtml      = regexp.MustCompile(`(?i)</t[dh]>`)
+	tagHtml       = regexp.MustCompile(`<[^>]*>`)
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText derives the plain text alternative of a mail from its html: tags are removed, block elements end a line
+func htmlToText(body string) string {
+	text := invisibleHtml.ReplaceAllString(body, "")
+	text = lineBreakHtml.ReplaceAllString(text, "\n")
+	text = listItemHtml.ReplaceAllString(text, "- ")
+	text = cellHtml.ReplaceAllString(text, " ")
+	text = html.UnescapeString(tagHtml.ReplaceAllString(text, ""))
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")) + "\n"
+}
+
+// error of a channel that sent the fallback message because its template could not be rendered
+func fallbackError(renderError error, sendError error) error {
+	if renderError == nil {
+		return sendError
+	}
+	if sendError != nil {
+		return errors.New(fmt.Sprintf("%v, sending the plain fallback message failed as well: %v", renderError, sendError))
+	}
+	return errors.New(fmt.Sprintf("%v, sent a plain fallback message instead", renderError))
+}
+
+func (event OpenAlertsEvent) eventAlerts() []Alert {
+	return event.NewAlerts
+}
+
+func (event ClosedAlertsEvent) eventAlerts() []Alert {
+	return event.Alerts
+}
+
+func (event FlappingAlertsEvent) eventAlerts() []Alert {
+	return event.Alerts
+}
+
+func (event SeverityChangedEvent) eventAlerts() []Alert {
+	return event.Alerts
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedDefaultTemplates(t *testing.T) {
+
+	// outside of the repository only the embedded templates are available
+	cache := newTemplateCache(t.TempDir())
+	if _, err := cache.htmlTemplate("templates/open_alerts.gohtml", MailChannel{}.htmlFuncs()); err != nil {
+		t.Fatalf("cannot load embedded template: %v", err)
+	}
+	if _, err := cache.textTemplate("templates/unknown.gotxt", nil); err == nil {
+		t.Fatalf("expected error for unknown template")
+	}
+}
+
+func TestTemplatesOnDiskOverrideTheDefaults(t *testing.T) {
+
+	directory := t.TempDir()
+	os.Mkdir(filepath.Join(directory, "templates"), 0755)
+	ioutil.WriteFile(filepath.Join(directory, "templates", "open_alerts.gotxt"), []byte("customized"), 0644)
+
+	cache := newTemplateCache(directory)
+	custom, err := cache.textTemplate("templates/open_alerts.gotxt", nil)
+	if err != nil {
+		t.Fatalf("cannot load customized template: %v", err)
+	}
+	var rendered strings.Builder
+	if err := custom.Execute(&rendered, nil); err != nil || rendered.String() != "customized" {
+		t.Fatalf("expected the template on disk to override the default, got %q (%v)", rendered.String(), err)
+	}
+	if !cache.exists("templates/open_alerts.gotxt") || cache.exists("templates/open_alerts.nl.gotxt") {
+		t.Fatalf("expected only the customized template to exist")
+	}
+}
+
+func TestInvalidTemplatesAreRejectedAtStartup(t *testing.T) {
+
+	directory := t.TempDir()
+	broken := filepath.Join(directory, "broken.gohtml")
+	ioutil.WriteFile(broken, []byte("{{ range .NewAlerts }}"), 0644)
+
+	config := Config{Channels: map[string]ChannelConfig{
+		"mail": {Type: "mail", Config: map[string]string{"to": "ops@example.com", "template_open": broken}},
+	}}
+	if _, err := LoadChannels(config); err == nil || !strings.Contains(err.Error(), "broken.gohtml") {
+		t.Fatalf("expected error for broken template, got %v", err)
+	}
+
+	config.Channels["mail"].Config["template_open"] = filepath.Join(directory, "missing.gohtml")
+	if _, err := LoadChannels(config); err == nil {
+		t.Fatalf("expected error for missing template")
+	}
+}
+
+func TestRenderErrorSendsFallbackMessage(t *testing.T) {
+
+	directory := t.TempDir()
+	failing := filepath.Join(directory, "failing.gohtml")
+	ioutil.WriteFile(failing, []byte("{{ .Unknown.Field }}"), 0644)
+
+	channel := MailChannel{settings: Smtp{From: "alerta@example.com", Transport: TransportFile, Directory: directory}, To: []string{"ops@example.com"}, TemplateOpen: failing}
+	event := OpenAlertsEvent{NewAlertCount: 1, NewAlerts: []Alert{{Resource: "db", Event: "down", Severity: "major"}}}
+
+	err := channel.SendOpenAlerts(event, false)
+	if err == nil || !strings.Contains(err.Error(), "fallback") {
+		t.Fatalf("expected render error reporting the fallback message, got %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(directory, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected the fallback mail to be sent, got %v", files)
+	}
+	raw, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(raw), "[major] db: down") {
+		t.Fatalf("unexpected fallback mail:\n%s", raw)
+	}
+
+	slackChannel := SlackChannel{Channel: "#ops", TemplateOpen: failing}
+	msg, err := event.toWebhookMessage(slackChannel)
+	if err == nil || msg.Channel != "#ops" || !strings.Contains(msg.Text, "[major] db: down") {
+		t.Fatalf("expected plain fallback slack message, got %+v (%v)", msg, err)
+	}
+}
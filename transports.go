@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TransportSmtp     = "smtp"
+	TransportSendmail = "sendmail"
+	TransportFile     = "file"
+	TransportMaildir  = "maildir"
+
+	defaultSendmailPath = "/usr/sbin/sendmail"
+)
+
+// sequence number to keep the names of mail files unique within the process
+var mailFileSequence uint64
+
+func (settings Smtp) transport() string {
+	return strings.ToLower(getOrElse(settings.Transport, TransportSmtp))
+}
+
+// sendmail pipes the message to a sendmail compatible binary of the local MTA
+func sendmail(settings Smtp, from string, to []string, msg []byte) error {
+
+	args := append(make([]string, 0), settings.SendmailArgs...)
+	// -i: a line with a single dot doesn't end the message, -f: envelope sender
+	args = append(args, "-i", "-f", from, "--")
+	for _, recipient := range to {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return err
+		}
+		args = append(args, address.Address)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), settings.timeout())
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, getOrElse(settings.SendmailPath, defaultSendmailPath), args...)
+	cmd.Stdin = bytes.NewReader(msg)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return errors.New(fmt.Sprintf("sendmail failed: %v: %v", err, strings.TrimSpace(output.String())))
+	}
+	return nil
+}
+
+// writeMailFile writes the message as .eml file to the directory, e.g. for testing or auditing
+func writeMailFile(directory string, msg []byte) error {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(directory, uniqueMailName()+".eml"), msg, 0644)
+}
+
+// writeMaildir delivers the message to a maildir: it is written to tmp and then moved to new,
+// so readers of the maildir never see partially written messages
+func writeMaildir(directory string, msg []byte) error {
+	for _, subdirectory := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(directory, subdirectory), 0700); err != nil {
+			return err
+		}
+	}
+
+	name := uniqueMailName()
+	tmp := filepath.Join(directory, "tmp", name)
+	if err := ioutil.WriteFile(tmp, msg, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(directory, "new", name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// unique file name following the maildir convention <time>.<pid>_<sequence>.<host>
+func uniqueMailName() string {
+	hostname, _ := os.Hostname()
+	hostname = strings.NewReplacer("/", "_", ":", "_").Replace(getOrElse(hostname, "localhost"))
+	now := time.Now()
+	sequence := atomic.AddUint64(&mailFileSequence, 1)
+	return fmt.Sprintf("%v.M%vP%v_%v.%v", now.Unix(), now.Nanosecond()/1000, os.Getpid(), sequence, hostname)
+}
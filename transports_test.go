@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testMailChannel(settings Smtp) MailChannel {
+	settings.From = "alerta@example.com"
+	return MailChannel{settings: settings, To: []string{"Ops <ops@example.com>"}, Bcc: []string{"audit@example.com"}}
+}
+
+func TestFileTransport(t *testing.T) {
+
+	directory := t.TempDir()
+
+	channel := testMailChannel(Smtp{Transport: TransportFile, Directory: directory})
+	for i := 0; i < 2; i++ {
+		if err := channel.Send("Alert on production", "<p>alert</p>", "alert", false); err != nil {
+			t.Fatalf("cannot write mail file: %v", err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(directory, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("expected 2 mail files, got %v", files)
+	}
+	raw, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(raw), "Subject: Alert on production") || strings.Contains(string(raw), "audit@example.com") {
+		t.Fatalf("unexpected mail file:\n%s", raw)
+	}
+}
+
+func TestMaildirTransport(t *testing.T) {
+
+	directory := t.TempDir()
+
+	channel := testMailChannel(Smtp{Transport: TransportMaildir, Directory: directory})
+	if err := channel.Send("Alert on production", "<p>alert</p>", "alert", false); err != nil {
+		t.Fatalf("cannot deliver to maildir: %v", err)
+	}
+
+	delivered, _ := ioutil.ReadDir(filepath.Join(directory, "new"))
+	pending, _ := ioutil.ReadDir(filepath.Join(directory, "tmp"))
+	if len(delivered) != 1 || len(pending) != 0 {
+		t.Fatalf("expected 1 delivered mail, got %v delivered and %v pending", len(delivered), len(pending))
+	}
+}
+
+func TestSendmailTransport(t *testing.T) {
+
+	directory := t.TempDir()
+
+	// fake sendmail binary recording its arguments and the message
+	script := filepath.Join(directory, "sendmail")
+	ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > \"$0.args\"\ncat > \"$0.msg\"\n"), 0755)
+
+	channel := testMailChannel(Smtp{Transport: TransportSendmail, SendmailPath: script, SendmailArgs: []string{"-oi"}})
+	if err := channel.Send("Alert on production", "<p>alert</p>", "alert", false); err != nil {
+		t.Fatalf("cannot send with sendmail: %v", err)
+	}
+
+	args, _ := ioutil.ReadFile(script + ".args")
+	if strings.TrimSpace(string(args)) != "-oi -i -f alerta@example.com -- ops@example.com audit@example.com" {
+		t.Fatalf("unexpected sendmail arguments: %s", args)
+	}
+	msg, _ := ioutil.ReadFile(script + ".msg")
+	if !strings.Contains(string(msg), "Subject: Alert on production") {
+		t.Fatalf("unexpected message:\n%s", msg)
+	}
+
+	failing := testMailChannel(Smtp{Transport: TransportSendmail, SendmailPath: "/bin/false"})
+	if err := failing.Send("Alert", "", "", false); err == nil {
+		t.Fatalf("expected error when sendmail fails")
+	}
+}
+
+func TestMailTransportSettings(t *testing.T) {
+
+	if _, err := smtpSettings(ChannelSettings{Smtp: Smtp{Transport: "pigeon"}}, "test", map[string]string{}); err == nil {
+		t.Fatalf("expected error for unknown transport")
+	}
+	if _, err := smtpSettings(ChannelSettings{Smtp: Smtp{Transport: "maildir"}}, "test", map[string]string{}); err == nil {
+		t.Fatalf("expected error for maildir transport without directory")
+	}
+}
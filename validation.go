@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// errors of the yaml decoder, e.g. "line 3: field chanels not found in type main.Config"
+	yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	unknownField  = regexp.MustCompile(`field (\S+) not found in type (\S+)`)
+)
+
+// the properties of the channel config by channel type, to detect typos
+var channelProperties = map[string][]string{
+	"mail": {
+		"to", "cc", "bcc", "reply_to", "from", "from_name", "smtp_profile", "subject_template",
+		"template_open", "template_closed", "template_flapping", "template_severity_changed",
+		"template_open_text", "template_closed_text", "template_flapping_text", "template_severity_changed_text",
+	},
+	"slack": {
+		"slack_channel", "workspace", "webhook_url", "webhook_url_file", "token", "token_file",
+		"template_open", "template_closed", "template_flapping", "template_severity_changed",
+	},
+	"": {"timezone", "language", "rate_limit_per_minute", "rate_limit_per_hour", "storm_threshold"},
+}
+
+// configPositions maps the paths of the configuration keys, e.g. alerta.reload_interval or inhibit_rules[0].equal,
+// to the file and line defining them
+type configPositions map[string]string
+
+// the position of the key, or of the closest parent key that has a position
+func (positions configPositions) of(path string) string {
+	for path != "" {
+		if position, ok := positions[path]; ok {
+			return position
+		}
+		if index := strings.LastIndexAny(path, ".["); index >= 0 {
+			path = path[:index]
+		} else {
+			path = ""
+		}
+	}
+	return positions[""]
+}
+
+// addYaml records the line of every key and list item of a yaml document. The list items are numbered after the
+// offset of their list, e.g. the inhibit rules of the files merged before.
+func (positions configPositions) addYaml(filename string, document *yaml.Node, offsets map[string]int) {
+
+	if _, ok := positions[""]; !ok {
+		positions[""] = filename
+	}
+
+	var add func(node *yaml.Node, path string)
+	add = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				add(child, path)
+			}
+		case yaml.AliasNode:
+			add(node.Alias, path)
+		case yaml.MappingNode:
+			for index := 0; index+1 < len(node.Content); index += 2 {
+				key, value := node.Content[index], node.Content[index+1]
+				if key.Tag == "!!merge" {
+					// the keys of a merged mapping are defined where the mapping is
+					add(value, path)
+					continue
+				}
+				keyPath := key.Value
+				if path != "" {
+					keyPath = path + "." + key.Value
+				}
+				positions[keyPath] = fmt.Sprintf("%v:%v", filename, key.Line)
+				add(value, keyPath)
+			}
+		case yaml.SequenceNode:
+			for index, item := range node.Content {
+				itemPath := fmt.Sprintf("%v[%v]", path, offsets[path]+index)
+				positions[itemPath] = fmt.Sprintf("%v:%v", filename, item.Line)
+				add(item, itemPath)
+			}
+		}
+	}
+	add(document, "")
+}
+
+// configErrors collects all problems of the configuration, so they can be fixed at once
+type configErrors struct {
+	positions configPositions
+	messages  []string
+}
+
+func (errs *configErrors) add(path string, format string, args ...interface{}) {
+	errs.messages = append(errs.messages, fmt.Sprintf("%v: %v: %v", errs.positions.of(path), path, fmt.Sprintf(format, args...)))
+}
+
+func (errs *configErrors) err() error {
+	if len(errs.messages) == 0 {
+		return nil
+	}
+	return errors.New(fmt.Sprintf("invalid configuration:\n  %v", strings.Join(errs.messages, "\n  ")))
+}
+
+// yamlError turns the errors of the strict yaml decoder into errors with file and line, with a suggestion for unknown keys
+func yamlError(filename string, err error) error {
+
+	messages := make([]string, 0)
+	lines := []string{err.Error()}
+	if typeError, ok := err.(*yaml.TypeError); ok {
+		lines = typeError.Errors
+	}
+	for _, line := range strings.Split(strings.Join(lines, "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "yaml: unmarshal errors:" {
+			continue
+		}
+		if match := yamlErrorLine.FindStringSubmatch(line); match != nil {
+			line = fmt.Sprintf("%v:%v: %v", filename, match[1], match[2])
+		} else {
+			line = fmt.Sprintf("%v: %v", filename, line)
+		}
+		if match := unknownField.FindStringSubmatch(line); match != nil {
+			if suggestion := closest(match[1], configKeys()[match[2]]); suggestion != "" {
+				line = fmt.Sprintf("%v, did you mean '%v'?", line, suggestion)
+			}
+		}
+		messages = append(messages, line)
+	}
+	return errors.New(fmt.Sprintf("invalid configuration:\n  %v", strings.Join(messages, "\n  ")))
+}
+
+// the yaml keys of the configuration types by type name, e.g. main.Config
+func configKeys() map[string][]string {
+	keys := make(map[string][]string)
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			collect(t.Elem())
+		case reflect.Struct:
+			if _, ok := keys[t.String()]; ok {
+				return
+			}
+			keys[t.String()] = make([]string, 0, t.NumField())
+			for index := 0; index < t.NumField(); index++ {
+				field := t.Field(index)
+				if field.PkgPath == "" {
+					keys[t.String()] = append(keys[t.String()], yamlName(field))
+					collect(field.Type)
+				}
+			}
+		}
+	}
+	collect(reflect.TypeOf(Config{}))
+	return keys
+}
+
+// the candidate that is at most a few typos away from the name
+func closest(name string, candidates []string) string {
+	best, bestDistance := "", len(name)/3+1
+	for _, candidate := range candidates {
+		if distance := editDistance(name, candidate); distance <= bestDistance && distance < len(candidate) {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// the Levenshtein distance between the strings
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// validateConfig checks the values of the configuration and reports all problems with their file and line
+func validateConfig(config Config, positions configPositions) error {
+
+	errs := &configErrors{positions: positions}
+
+	if config.Alerta.Endpoint == "" {
+		errs.add("alerta.endpoint", "is required")
+	} else {
+		validateUrl(errs, "alerta.endpoint", config.Alerta.Endpoint)
+	}
+	if config.Alerta.Webui != "" {
+		validateUrl(errs, "alerta.webui", config.Alerta.Webui)
+	}
+	if config.Alerta.ReloadInterval <= 0 {
+		errs.add("alerta.reload_interval", "must be positive, got %v", config.Alerta.ReloadInterval)
+	}
+
+	if config.Workers < 0 {
+		errs.add("workers", "must not be negative, got %v", config.Workers)
+	}
+
+	validateSmtp(errs, "channel_settings.smtp", config.ChannelSettings.Smtp)
+	for _, name := range sortedKeys(config.ChannelSettings.SmtpProfiles) {
+		validateSmtp(errs, "channel_settings.smtp_profiles."+name, config.ChannelSettings.SmtpProfiles[name])
+	}
+	validateSlack(errs, "channel_settings.slack", config.ChannelSettings.Slack)
+	for _, name := range sortedKeys(config.ChannelSettings.SlackWorkspaces) {
+		validateSlack(errs, "channel_settings.slack_workspaces."+name, config.ChannelSettings.SlackWorkspaces[name])
+	}
+
+	for _, name := range sortedKeys(config.Channels) {
+		validateChannel(errs, "channels."+name, config.Channels[name])
+	}
+
+	for _, name := range sortedKeys(config.Rules) {
+		path := "rules." + name
+		rule := config.Rules[name]
+		if len(rule.Channels) == 0 {
+			errs.add(path+".channels", "at least one channel is required")
+		}
+		for index, channel := range rule.Channels {
+			if _, ok := config.Channels[channel]; !ok {
+				errs.add(fmt.Sprintf("%v.channels[%v]", path, index), "unknown channel '%v'", channel)
+			}
+		}
+		if rule.For < 0 {
+			errs.add(path+".for", "must not be negative, got %v", rule.For)
+		}
+		if rule.Interval < 0 {
+			errs.add(path+".interval", "must not be negative, got %v", rule.Interval)
+		}
+		if rule.Flapping.Threshold < 0 || rule.Flapping.Window < 0 || rule.Flapping.StablePeriod < 0 {
+			errs.add(path+".flapping", "threshold, window and stable_period must not be negative")
+		}
+		if rule.Flapping.Threshold > 0 && rule.Flapping.Window <= 0 {
+			errs.add(path+".flapping.window", "must be positive when a threshold is configured")
+		}
+	}
+
+	for index, inhibitRule := range config.InhibitRules {
+		path := fmt.Sprintf("inhibit_rules[%v]", index)
+		// without source_match every alert would inhibit all other alerts
+		if len(inhibitRule.SourceMatch) == 0 {
+			errs.add(path, "source_match is required")
+		}
+	}
+
+	return errs.err()
+}
+
+func validateSmtp(errs *configErrors, path string, settings Smtp) {
+	if settings.Port < 0 || settings.Port > 65535 {
+		errs.add(path+".port", "must be between 1 and 65535, got %v", settings.Port)
+	}
+	if settings.Timeout < 0 {
+		errs.add(path+".timeout", "must not be negative, got %v", settings.Timeout)
+	}
+}
+
+func validateSlack(errs *configErrors, path string, settings Slack) {
+	if settings.WebhookUrl != "" && !isUrl(string(settings.WebhookUrl)) {
+		errs.add(path+".webhook_url", "must be a http or https url")
+	}
+}
+
+func validateChannel(errs *configErrors, path string, channel ChannelConfig) {
+
+	known, ok := channelProperties[channel.Type]
+	if !ok || channel.Type == "" {
+		errs.add(path+".type", "unknown channel type '%v': valid types are mail, slack", channel.Type)
+		return
+	}
+	known = append(append(make([]string, 0), known...), channelProperties[""]...)
+
+	for _, key := range sortedKeys(channel.Config) {
+		value := channel.Config[key]
+		propertyPath := path + ".config." + key
+		switch {
+		case !containsString(known, key):
+			if suggestion := closest(key, known); suggestion != "" {
+				errs.add(propertyPath, "unknown property of a %v channel, did you mean '%v'?", channel.Type, suggestion)
+			} else {
+				errs.add(propertyPath, "unknown property of a %v channel", channel.Type)
+			}
+		case key == "webhook_url" && !isUrl(value):
+			errs.add(propertyPath, "must be a http or https url")
+		case strings.HasPrefix(key, "rate_limit_") || key == "storm_threshold":
+			if limit, err := strconv.Atoi(value); err != nil || limit < 0 {
+				errs.add(propertyPath, "must be zero or a positive number, got '%v'", value)
+			}
+		}
+	}
+	if channel.Type == "mail" && channel.Config["to"] == "" {
+		errs.add(path+".config", "'to' is required for a mail channel")
+	}
+}
+
+func validateUrl(errs *configErrors, path string, value string) {
+	if !isUrl(value) {
+		errs.add(path, "must be a http or https url, got '%v'", value)
+	}
+}
+
+func isUrl(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// the keys of a map with string keys in order, so problems are reported in a stable order
+func sortedKeys(values interface{}) []string {
+	keys := make([]string, 0)
+	for _, key := range reflect.ValueOf(values).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
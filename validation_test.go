@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the error of loading the configuration, with the name of the temporary file replaced by config.yml
+func loadTestConfig(t *testing.T, content string) string {
+	directory := t.TempDir()
+
+	filename := filepath.Join(directory, "config.yml")
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(filename); err != nil {
+		return strings.Replace(err.Error(), filename, "config.yml", -1)
+	}
+	return ""
+}
+
+func TestUnknownKeysAreReported(t *testing.T) {
+
+	err := loadTestConfig(t, `
+alerta:
+  endpoint: http://alerta:8080/api
+  reload_intervall: 60
+chanels:
+  support:
+    type: mail
+`)
+	for _, expected := range []string{
+		"config.yml:4: field reload_intervall not found in type main.Alerta, did you mean 'reload_interval'?",
+		"config.yml:5: field chanels not found in type main.Config, did you mean 'channels'?",
+	} {
+		if !strings.Contains(err, expected) {
+			t.Errorf("expected '%v', got %v", expected, err)
+		}
+	}
+}
+
+func TestInvalidValuesAreReportedWithTheirLine(t *testing.T) {
+
+	err := loadTestConfig(t, `
+alerta:
+  endpoint: alerta:8080
+  reload_interval: 0
+channel_settings:
+  smtp:
+    port: 70000
+channels:
+  support:
+    type: mail
+    config:
+      to: support@example.com
+      tempate_open: templates/support.gohtml
+  chat:
+    type: slack
+    config:
+      webhook_url: 'hooks.slack.com/services/1/2/3'
+rules:
+  support:
+    channels:
+      - support
+      - marketing
+    flapping:
+      threshold: 3
+inhibit_rules:
+  - target_match:
+      severity: minor
+`)
+	for _, expected := range []string{
+		"config.yml:3: alerta.endpoint: must be a http or https url, got 'alerta:8080'",
+		"config.yml:4: alerta.reload_interval: must be positive",
+		"config.yml:7: channel_settings.smtp.port: must be between 1 and 65535, got 70000",
+		"config.yml:13: channels.support.config.tempate_open: unknown property of a mail channel, did you mean 'template_open'?",
+		"config.yml:17: channels.chat.config.webhook_url: must be a http or https url",
+		"config.yml:22: rules.support.channels[1]: unknown channel 'marketing'",
+		"config.yml:23: rules.support.flapping.window: must be positive when a threshold is configured",
+		"config.yml:26: inhibit_rules[0]: source_match is required",
+	} {
+		if !strings.Contains(err, expected) {
+			t.Errorf("expected '%v', got %v", expected, err)
+		}
+	}
+	if strings.Contains(err, "hooks.slack.com") {
+		t.Errorf("expected the webhook url not to be shown, got %v", err)
+	}
+}
+
+func TestFlowStyleAndAnchorsAreReportedWithTheirLine(t *testing.T) {
+
+	err := loadTestConfig(t, `
+alerta:
+  endpoint: http://alerta:8080/api
+  reload_interval: 60
+channels:
+  support: {type: mail, config: {to: support@example.com, "tempate_open": templates/support.gohtml}}
+rules:
+  support: &rule
+    channels: [support,
+      marketing]
+  copy:
+    <<: *rule
+`)
+	for _, expected := range []string{
+		"config.yml:6: channels.support.config.tempate_open: unknown property of a mail channel, did you mean 'template_open'?",
+		"config.yml:10: rules.support.channels[1]: unknown channel 'marketing'",
+		"config.yml:10: rules.copy.channels[1]: unknown channel 'marketing'",
+	} {
+		if !strings.Contains(err, expected) {
+			t.Errorf("expected '%v', got %v", expected, err)
+		}
+	}
+}
+
+// every key of the configuration must be documented in the json schema
+func TestSchemaDescribesAllKeys(t *testing.T) {
+
+	raw, err := ioutil.ReadFile("config/config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("invalid json schema: %v", err)
+	}
+	definitions := schema["definitions"].(map[string]interface{})
+
+	resolve := func(node map[string]interface{}) map[string]interface{} {
+		if ref, ok := node["$ref"].(string); ok {
+			return definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+		}
+		return node
+	}
+
+	var check func(path string, typ reflect.Type, node map[string]interface{})
+	check = func(path string, typ reflect.Type, node map[string]interface{}) {
+		node = resolve(node)
+		switch typ.Kind() {
+		case reflect.Struct:
+			properties, _ := node["properties"].(map[string]interface{})
+			for index := 0; index < typ.NumField(); index++ {
+				field := typ.Field(index)
+				if field.PkgPath != "" {
+					continue
+				}
+				property, ok := properties[yamlName(field)].(map[string]interface{})
+				if !ok {
+					t.Errorf("%v.%v is missing in the json schema", path, yamlName(field))
+					continue
+				}
+				check(path+"."+yamlName(field), field.Type, property)
+			}
+		case reflect.Map:
+			if items, ok := node["additionalProperties"].(map[string]interface{}); ok {
+				check(path+".*", typ.Elem(), items)
+			}
+		case reflect.Slice:
+			if items, ok := node["items"].(map[string]interface{}); ok {
+				check(path+"[]", typ.Elem(), items)
+			}
+		}
+	}
+	check("config", reflect.TypeOf(Config{}), schema)
+
+	for channelType, definition := range map[string]string{"mail": "mailChannelConfig", "slack": "slackChannelConfig"} {
+		properties := definitions[definition].(map[string]interface{})["properties"].(map[string]interface{})
+		known := append(append(make([]string, 0), channelProperties[channelType]...), channelProperties[""]...)
+		if len(properties) != len(known) {
+			t.Errorf("expected the %v channel properties %v in the json schema, got %v", channelType, known, properties)
+		}
+		for _, property := range known {
+			if _, ok := properties[property]; !ok {
+				t.Errorf("%v channel property %v is missing in the json schema", channelType, property)
+			}
+		}
+	}
+}